@@ -0,0 +1,45 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import "strconv"
+
+// A NonCanonicalError describes valid JSON input that is not in canonical
+// form.
+type NonCanonicalError struct {
+	Offset int64 // offset of the first byte that differs from canonical form
+}
+
+func (e *NonCanonicalError) Error() string {
+	return "canonicaljson: input is not in canonical form at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+// CheckCanonical returns nil if data is a single JSON value in canonical
+// form, exactly as Marshal would encode it. Otherwise it returns a
+// SyntaxError for invalid JSON or a NonCanonicalError for valid JSON in
+// any other form (including with surrounding whitespace).
+func CheckCanonical(data []byte) error {
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return err
+	}
+	i := 0
+	for i < len(data) && i < len(canonical) && data[i] == canonical[i] {
+		i++
+	}
+	if i < len(data) || i < len(canonical) {
+		return &NonCanonicalError{int64(i)}
+	}
+	return nil
+}
+
+// canonicalize returns the canonical form of the JSON value in data.
+func canonicalize(data []byte) ([]byte, error) {
+	v, err := unmarshalGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(v)
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"reflect"
+	"testing"
+)
+
+var checkCanonicalTests = []struct {
+	in  string
+	err error
+}{
+	{in: `null`},
+	{in: `{"a":[1,1.0E-1,"\u001F"],"b":{}}`},
+	{in: `9007199254740993`},
+	{in: `"\uD800"`},
+	{in: `{"b":1,"a":2}`, err: &NonCanonicalError{2}},
+	{in: `{"a":1, "b":2}`, err: &NonCanonicalError{7}},
+	{in: `1.0`, err: &NonCanonicalError{1}},
+	{in: `0.1`, err: &NonCanonicalError{0}},
+	{in: `"\u00E9"`, err: &NonCanonicalError{1}},
+	{in: `"\u001f"`, err: &NonCanonicalError{6}},
+	{in: ` true`, err: &NonCanonicalError{0}},
+	{in: `true `, err: &NonCanonicalError{4}},
+	{in: `[1,2`, err: &SyntaxError{"unexpected end of JSON input", 4}},
+	{in: `[] []`, err: &SyntaxError{"invalid character '[' after top-level value", 4}},
+}
+
+func TestCheckCanonical(t *testing.T) {
+	for _, tt := range checkCanonicalTests {
+		err := CheckCanonical([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("CheckCanonical(%#q) = %#v, want %#v", tt.in, err, tt.err)
+		}
+	}
+}
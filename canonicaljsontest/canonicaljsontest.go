@@ -0,0 +1,65 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package canonicaljsontest provides test helpers for comparing JSON
+// documents by their canonical forms.
+package canonicaljsontest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+// AssertEqual reports a test error if want and got are not semantically
+// equal JSON documents, listing each differing JSON Pointer path along
+// with its canonical old (want) and new (got) values.
+// Values of type []byte, string, canonicaljson.RawMessage, and
+// json.RawMessage are treated as JSON text; any other value is first
+// encoded with canonicaljson.Marshal.
+// It returns true if the documents are equal.
+func AssertEqual(t testing.TB, want, got interface{}) bool {
+	t.Helper()
+	wantJSON, err := toJSON(want)
+	if err != nil {
+		t.Errorf("canonicaljsontest: want: %v", err)
+		return false
+	}
+	gotJSON, err := toJSON(got)
+	if err != nil {
+		t.Errorf("canonicaljsontest: got: %v", err)
+		return false
+	}
+	diffs, err := canonicaljson.Diff(wantJSON, gotJSON)
+	if err != nil {
+		t.Errorf("canonicaljsontest: %v", err)
+		return false
+	}
+	if len(diffs) == 0 {
+		return true
+	}
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = "\t" + d.String()
+	}
+	t.Errorf("JSON documents differ (want => got):\n%s", strings.Join(lines, "\n"))
+	return false
+}
+
+// toJSON returns v as JSON text.
+func toJSON(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case canonicaljson.RawMessage:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	}
+	return canonicaljson.Marshal(v)
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljsontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// recorder is a testing.TB that records reported errors.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertEqual(t *testing.T) {
+	type point struct {
+		X, Y float64
+	}
+	for i, tt := range []struct {
+		want, got interface{}
+	}{
+		{`{"a":1,"b":[1.5]}`, []byte(`{"b":[15e-1],"a":1.0}`)},
+		{json.RawMessage(`{"X":1,"Y":0.5}`), point{1, 0.5}},
+		{map[string]interface{}{"k": "v"}, `{"k":"v"}`},
+	} {
+		r := &recorder{TB: t}
+		if !AssertEqual(r, tt.want, tt.got) || len(r.errors) != 0 {
+			t.Errorf("#%d: AssertEqual(%v, %v) reported %q", i, tt.want, tt.got, r.errors)
+		}
+	}
+}
+
+func TestAssertEqualFailure(t *testing.T) {
+	r := &recorder{TB: t}
+	if AssertEqual(r, `{"a":1,"b":{"c":true}}`, `{"a":2,"b":{}}`) {
+		t.Fatal("AssertEqual returned true for different documents")
+	}
+	want := "JSON documents differ (want => got):\n\t/a: 1 => 2\n\t/b/c: removed true"
+	if len(r.errors) != 1 || r.errors[0] != want {
+		t.Errorf("AssertEqual reported %q, want %q", r.errors, want)
+	}
+
+	r = &recorder{TB: t}
+	if AssertEqual(r, `{`, `{}`) || len(r.errors) != 1 {
+		t.Errorf("AssertEqual with invalid JSON reported %q", r.errors)
+	}
+}
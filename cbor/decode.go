@@ -0,0 +1,890 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gibson042/canonicaljson-go"
+	"github.com/gibson042/canonicaljson-go/internal/fields"
+)
+
+// Unmarshal parses the CBOR-encoded data and stores the result
+// in the value pointed to by v.
+//
+// Unmarshal uses the inverse of the encodings that Marshal uses,
+// following the same rules as canonicaljson.Unmarshal for pointers,
+// structs, maps, slices, and arrays. To unmarshal CBOR into an interface
+// value, Unmarshal stores one of these in the interface value:
+//
+//	bool, for CBOR booleans
+//	int64, for CBOR integers that fit (otherwise uint64 or Number)
+//	float64, for CBOR floats
+//	canonicaljson.Number, for CBOR bignums and decimal fractions
+//	string, for CBOR text strings
+//	[]byte, for CBOR byte strings
+//	[]interface{}, for CBOR arrays
+//	map[string]interface{}, for CBOR maps
+//	nil for CBOR null and undefined
+//
+// Values implementing json.Unmarshaler receive the canonical JSON
+// encoding of the corresponding data item.
+//
+// Unmarshal accepts any well-formed encoding that uses definite lengths,
+// not only the deterministic encoding produced by Marshal. Map keys must
+// be text strings, and tags other than bignums and decimal fractions are
+// ignored in favor of their content.
+func Unmarshal(data []byte, v interface{}) error {
+	// Check for well-formedness.
+	// Avoids filling out half a data structure
+	// before discovering a CBOR syntax error.
+	d := &decodeState{data: data}
+	if err := d.checkValid(); err != nil {
+		return err
+	}
+	d.off = 0
+	return d.unmarshal(v)
+}
+
+// An UnmarshalTypeError describes a CBOR value that was
+// not appropriate for a value of a specific Go type.
+type UnmarshalTypeError struct {
+	Value  string       // description of CBOR value - "bool", "array", "integer -5"
+	Type   reflect.Type // type of Go value it could not be assigned to
+	Offset int64        // error occurred after reading Offset bytes
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "cbor: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+// An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// (The argument to Unmarshal must be a non-nil pointer.)
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "cbor: Unmarshal(nil)"
+	}
+
+	if e.Type.Kind() != reflect.Ptr {
+		return "cbor: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "cbor: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// A SyntaxError is a description of a CBOR syntax error.
+type SyntaxError struct {
+	msg    string // description of error
+	Offset int64  // error occurred after reading Offset bytes
+}
+
+func (e *SyntaxError) Error() string { return e.msg }
+
+// maxDepth bounds the nesting of arrays, maps, and tags accepted by
+// Unmarshal.
+const maxDepth = 10000
+
+// decodeState represents the state while decoding a CBOR data item.
+type decodeState struct {
+	data       []byte
+	off        int // read offset in data
+	savedError error
+}
+
+func (d *decodeState) unmarshal(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			err = r.(error)
+		}
+	}()
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+
+	d.value(rv)
+	return d.savedError
+}
+
+// error aborts the decoding by panicking with err.
+func (d *decodeState) error(err error) {
+	panic(err)
+}
+
+// saveError saves the first err it is called with,
+// for reporting at the end of the unmarshal.
+func (d *decodeState) saveError(err error) {
+	if d.savedError == nil {
+		d.savedError = err
+	}
+}
+
+func (d *decodeState) syntaxError(msg string) error {
+	return &SyntaxError{"cbor: " + msg, int64(d.off)}
+}
+
+// head reads the initial byte and argument of the data item at d.off,
+// returning its major type, additional information, and argument.
+func (d *decodeState) head() (major, info byte, arg uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, 0, d.syntaxError("unexpected end of CBOR input")
+	}
+	c := d.data[d.off]
+	major, info = c&0xE0, c&0x1F
+	d.off++
+	var n int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	case info == 31:
+		return 0, 0, 0, d.syntaxError("indefinite-length items are not supported")
+	default:
+		return 0, 0, 0, d.syntaxError("reserved additional information " + strconv.Itoa(int(info)))
+	}
+	if len(d.data)-d.off < n {
+		return 0, 0, 0, d.syntaxError("unexpected end of CBOR input")
+	}
+	for _, b := range d.data[d.off : d.off+n] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.off += n
+	return major, info, arg, nil
+}
+
+// checkValid verifies that d.data holds exactly one well-formed data item.
+func (d *decodeState) checkValid() error {
+	if err := d.skip(0); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return d.syntaxError("invalid data after top-level value")
+	}
+	return nil
+}
+
+// skip advances d.off past the data item at d.off, checking that it is
+// well-formed.
+func (d *decodeState) skip(depth int) error {
+	if depth > maxDepth {
+		return d.syntaxError("exceeded max depth")
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorBytes, majorText:
+		if arg > uint64(len(d.data)-d.off) {
+			return d.syntaxError("unexpected end of CBOR input")
+		}
+		s := d.data[d.off : d.off+int(arg)]
+		if major == majorText && !utf8.Valid(s) {
+			return d.syntaxError("invalid UTF-8 in text string")
+		}
+		d.off += int(arg)
+	case majorArray, majorMap:
+		n := arg
+		if major == majorMap {
+			if n > math.MaxUint64/2 {
+				return d.syntaxError("unexpected end of CBOR input")
+			}
+			n *= 2
+		}
+		// Each item is at least one byte.
+		if n > uint64(len(d.data)-d.off) {
+			return d.syntaxError("unexpected end of CBOR input")
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case majorTag:
+		return d.skip(depth + 1)
+	case majorSimple:
+		if info == 24 && arg < 32 {
+			return d.syntaxError("invalid two-byte simple value")
+		}
+	}
+	return nil
+}
+
+// value decodes the data item at d.off into v, advancing past it.
+func (d *decodeState) value(v reflect.Value) {
+	start := d.off
+	major, info, arg, err := d.head()
+	if err != nil {
+		d.error(err)
+	}
+
+	if !v.IsValid() {
+		d.off = start
+		if err := d.skip(0); err != nil {
+			d.error(err)
+		}
+		return
+	}
+
+	decodingNull := major == majorSimple && (info == 22 || info == 23)
+	u, ut, pv := d.indirect(v, decodingNull)
+	if u != nil {
+		d.off = start
+		x := d.valueInterface()
+		b, err := canonicaljson.Marshal(x)
+		if err == nil {
+			err = u.UnmarshalJSON(b)
+		}
+		if err != nil {
+			d.error(err)
+		}
+		return
+	}
+	if ut != nil {
+		if major != majorText {
+			d.saveError(&UnmarshalTypeError{describe(major, info), v.Type(), int64(d.off)})
+			d.off = start
+			d.skip(0)
+			return
+		}
+		s := d.data[d.off : d.off+int(arg)]
+		d.off += int(arg)
+		if err := ut.UnmarshalText(s); err != nil {
+			d.error(err)
+		}
+		return
+	}
+	v = pv
+
+	switch major {
+	case majorUint:
+		d.storeInt(v, new(big.Int).SetUint64(arg))
+	case majorNegInt:
+		n := new(big.Int).SetUint64(arg)
+		d.storeInt(v, n.Not(n))
+	case majorBytes:
+		b := d.data[d.off : d.off+int(arg)]
+		d.off += int(arg)
+		d.storeBytes(v, b)
+	case majorText:
+		s := string(d.data[d.off : d.off+int(arg)])
+		d.off += int(arg)
+		d.storeText(v, s)
+	case majorArray:
+		d.array(v, start, arg)
+	case majorMap:
+		d.object(v, start, arg)
+	case majorTag:
+		d.tag(v, start, arg)
+	case majorSimple:
+		d.simple(v, info, arg)
+	}
+}
+
+// describe returns a description of a CBOR data item for use in errors.
+func describe(major, info byte) string {
+	switch major {
+	case majorUint, majorNegInt:
+		return "integer"
+	case majorBytes:
+		return "byte string"
+	case majorText:
+		return "text string"
+	case majorArray:
+		return "array"
+	case majorMap:
+		return "map"
+	case majorTag:
+		return "tag"
+	}
+	switch info {
+	case 20, 21:
+		return "bool"
+	case 22, 23:
+		return "null"
+	case 25, 26, 27:
+		return "float"
+	}
+	return "simple value"
+}
+
+// indirect walks down v allocating pointers as needed,
+// until it gets to a non-pointer.
+// if it encounters an Unmarshaler, indirect stops and returns that.
+// if decodingNull is true, indirect stops at the last pointer so it can be set to nil.
+func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
+	// If v is a named type and is addressable,
+	// start with its address, so that if the type has pointer methods,
+	// we find them.
+	if v.Kind() != reflect.Ptr && v.Type().Name() != "" && v.CanAddr() {
+		v = v.Addr()
+	}
+	for {
+		// Load value from interface, but only if the result will be
+		// usefully addressable.
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Ptr && !e.IsNil() && (!decodingNull || e.Elem().Kind() == reflect.Ptr) {
+				v = e
+				continue
+			}
+		}
+
+		if v.Kind() != reflect.Ptr {
+			break
+		}
+
+		if v.Elem().Kind() != reflect.Ptr && decodingNull && v.CanSet() {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 {
+			if u, ok := v.Interface().(json.Unmarshaler); ok {
+				return u, nil, reflect.Value{}
+			}
+			if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+				return nil, u, reflect.Value{}
+			}
+		}
+		v = v.Elem()
+	}
+	return nil, nil, v
+}
+
+// storeInt stores the integer n into v.
+func (d *decodeState) storeInt(v reflect.Value, n *big.Int) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !n.IsInt64() || v.OverflowInt(n.Int64()) {
+			d.saveError(&UnmarshalTypeError{"integer " + n.String(), v.Type(), int64(d.off)})
+			return
+		}
+		v.SetInt(n.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+			d.saveError(&UnmarshalTypeError{"integer " + n.String(), v.Type(), int64(d.off)})
+			return
+		}
+		v.SetUint(n.Uint64())
+	case reflect.Float32, reflect.Float64:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		if v.OverflowFloat(f) {
+			d.saveError(&UnmarshalTypeError{"integer " + n.String(), v.Type(), int64(d.off)})
+			return
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if v.Type() != numberType && v.Type() != jsonNumberType {
+			d.saveError(&UnmarshalTypeError{"integer", v.Type(), int64(d.off)})
+			return
+		}
+		v.SetString(n.String())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			d.saveError(&UnmarshalTypeError{"integer", v.Type(), int64(d.off)})
+			return
+		}
+		v.Set(reflect.ValueOf(intInterface(n)))
+	default:
+		d.saveError(&UnmarshalTypeError{"integer", v.Type(), int64(d.off)})
+	}
+}
+
+// intInterface returns n as an int64, uint64, or Number.
+func intInterface(n *big.Int) interface{} {
+	switch {
+	case n.IsInt64():
+		return n.Int64()
+	case n.IsUint64():
+		return n.Uint64()
+	}
+	return canonicaljson.Number(n.String())
+}
+
+// storeDecimal stores the number with text s (a valid JSON number) into v.
+func (d *decodeState) storeDecimal(v reflect.Value, s string) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil || v.OverflowFloat(f) {
+			d.saveError(&UnmarshalTypeError{"number " + s, v.Type(), int64(d.off)})
+			return
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if v.Type() != numberType && v.Type() != jsonNumberType {
+			d.saveError(&UnmarshalTypeError{"number", v.Type(), int64(d.off)})
+			return
+		}
+		v.SetString(s)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			d.saveError(&UnmarshalTypeError{"number", v.Type(), int64(d.off)})
+			return
+		}
+		v.Set(reflect.ValueOf(canonicaljson.Number(s)))
+	default:
+		d.saveError(&UnmarshalTypeError{"number " + s, v.Type(), int64(d.off)})
+	}
+}
+
+// storeFloat stores the float f into v.
+func (d *decodeState) storeFloat(v reflect.Value, f float64) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			d.saveError(&UnmarshalTypeError{"float " + strconv.FormatFloat(f, 'g', -1, 64), v.Type(), int64(d.off)})
+			return
+		}
+		v.SetFloat(f)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			d.saveError(&UnmarshalTypeError{"float", v.Type(), int64(d.off)})
+			return
+		}
+		v.Set(reflect.ValueOf(f))
+	default:
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			d.saveError(&UnmarshalTypeError{"float " + strconv.FormatFloat(f, 'g', -1, 64), v.Type(), int64(d.off)})
+			return
+		}
+		d.storeDecimal(v, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+func (d *decodeState) storeBytes(v reflect.Value, b []byte) {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		v.SetBytes(append([]byte{}, b...))
+		return
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		v.Set(reflect.ValueOf(append([]byte{}, b...)))
+		return
+	}
+	d.saveError(&UnmarshalTypeError{"byte string", v.Type(), int64(d.off)})
+}
+
+func (d *decodeState) storeText(v reflect.Value, s string) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Type() == numberType || v.Type() == jsonNumberType {
+			break
+		}
+		v.SetString(s)
+		return
+	case reflect.Slice:
+		// Accept the JSON representation of []byte.
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			d.saveError(err)
+			return
+		}
+		v.SetBytes(b)
+		return
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		v.Set(reflect.ValueOf(s))
+		return
+	}
+	d.saveError(&UnmarshalTypeError{"text string", v.Type(), int64(d.off)})
+}
+
+// array decodes an array of n items (the head of which started at start)
+// into v.
+func (d *decodeState) array(v reflect.Value, start int, n uint64) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			d.off = start
+			v.Set(reflect.ValueOf(d.valueInterface()))
+			return
+		}
+		fallthrough
+	default:
+		d.saveError(&UnmarshalTypeError{"array", v.Type(), int64(d.off)})
+		d.off = start
+		d.skip(0)
+		return
+	case reflect.Array:
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() < int(n) {
+			v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		} else {
+			v.SetLen(int(n))
+		}
+	}
+
+	i := 0
+	for ; uint64(i) < n; i++ {
+		if i < v.Len() {
+			d.value(v.Index(i))
+		} else {
+			// Ran out of fixed array: skip.
+			d.value(reflect.Value{})
+		}
+	}
+	if v.Kind() == reflect.Array {
+		// Array. Zero the rest.
+		z := reflect.Zero(v.Type().Elem())
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(z)
+		}
+	}
+}
+
+// object decodes a map of n pairs (the head of which started at start)
+// into v.
+func (d *decodeState) object(v reflect.Value, start int, n uint64) {
+	// Decoding into nil interface?  Switch to non-reflect code.
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		d.off = start
+		v.Set(reflect.ValueOf(d.valueInterface()))
+		return
+	}
+
+	// Check type of target: struct or map[string]T
+	switch v.Kind() {
+	case reflect.Map:
+		t := v.Type()
+		if t.Key().Kind() != reflect.String {
+			d.saveError(&UnmarshalTypeError{"map", v.Type(), int64(d.off)})
+			d.off = start
+			d.skip(0)
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+	case reflect.Struct:
+
+	default:
+		d.saveError(&UnmarshalTypeError{"map", v.Type(), int64(d.off)})
+		d.off = start
+		d.skip(0)
+		return
+	}
+
+	var mapElem reflect.Value
+	var fs []fields.Field
+	var inline *fields.Field
+	if v.Kind() == reflect.Struct {
+		fs = fields.CachedTypeFields(v.Type())
+		inline = fields.Inline(fs)
+	}
+	for i := uint64(0); i < n; i++ {
+		key := d.key()
+
+		// Figure out field corresponding to key.
+		var subv reflect.Value
+		target := v // the map to store the value in, if any
+		if v.Kind() == reflect.Struct {
+			target = reflect.Value{}
+			var f *fields.Field
+			if inline != nil {
+				// Only exact matches, so that inline holds every other member.
+				if f = fields.LookupExact(fs, key); f == nil {
+					f = inline
+				}
+			} else {
+				f = fields.Lookup(fs, key)
+			}
+			if f != nil {
+				subv = v
+				for _, i := range f.Index {
+					if subv.Kind() == reflect.Ptr {
+						if subv.IsNil() {
+							subv.Set(reflect.New(subv.Type().Elem()))
+						}
+						subv = subv.Elem()
+					}
+					subv = subv.Field(i)
+				}
+				if f.Quoted {
+					d.valueQuoted(subv)
+					continue
+				}
+				if f.Inline {
+					if subv.IsNil() {
+						subv.Set(reflect.MakeMap(subv.Type()))
+					}
+					target = subv
+				}
+			}
+		}
+		if target.IsValid() && target.Kind() == reflect.Map {
+			elemType := target.Type().Elem()
+			if !mapElem.IsValid() {
+				mapElem = reflect.New(elemType).Elem()
+			} else {
+				mapElem.Set(reflect.Zero(elemType))
+			}
+			subv = mapElem
+		}
+
+		d.value(subv)
+
+		// Write value back to map;
+		// if using struct, subv points into struct already.
+		if target.IsValid() && target.Kind() == reflect.Map {
+			kv := reflect.ValueOf(string(key)).Convert(target.Type().Key())
+			target.SetMapIndex(kv, subv)
+		}
+	}
+}
+
+// key reads a text string map key.
+func (d *decodeState) key() []byte {
+	major, info, arg, err := d.head()
+	if err != nil {
+		d.error(err)
+	}
+	if major != majorText {
+		d.error(d.syntaxError("unsupported map key of type " + describe(major, info)))
+	}
+	key := d.data[d.off : d.off+int(arg)]
+	d.off += int(arg)
+	return key
+}
+
+// valueQuoted decodes a text string holding JSON (from the ",string"
+// struct tag option) into v.
+func (d *decodeState) valueQuoted(v reflect.Value) {
+	var x interface{}
+	d.value(reflect.ValueOf(&x).Elem())
+	switch qv := x.(type) {
+	case nil:
+	case string:
+		if err := canonicaljson.Unmarshal([]byte(qv), v.Addr().Interface()); err != nil {
+			d.saveError(err)
+		}
+	default:
+		d.saveError(errors.New("cbor: invalid use of ,string struct tag, trying to unmarshal unquoted value into " + v.Type().String()))
+	}
+}
+
+// tag decodes the tagged data item with tag number n (the head of which
+// started at start) into v.
+func (d *decodeState) tag(v reflect.Value, start int, n uint64) {
+	switch n {
+	case tagPosBignum, tagNegBignum:
+		major, _, arg, err := d.head()
+		if err != nil {
+			d.error(err)
+		}
+		if major != majorBytes {
+			d.error(d.syntaxError("bignum content is not a byte string"))
+		}
+		b := new(big.Int).SetBytes(d.data[d.off : d.off+int(arg)])
+		d.off += int(arg)
+		if n == tagNegBignum {
+			b.Not(b)
+		}
+		d.storeInt(v, b)
+	case tagDecimalFraction:
+		d.off = start
+		x := d.valueInterface()
+		d.storeDecimal(v, string(x.(canonicaljson.Number)))
+	default:
+		d.value(v)
+	}
+}
+
+func (d *decodeState) simple(v reflect.Value, info byte, arg uint64) {
+	switch info {
+	case 20, 21:
+		value := info == 21
+		switch v.Kind() {
+		default:
+			d.saveError(&UnmarshalTypeError{"bool", v.Type(), int64(d.off)})
+		case reflect.Bool:
+			v.SetBool(value)
+		case reflect.Interface:
+			if v.NumMethod() == 0 {
+				v.Set(reflect.ValueOf(value))
+			} else {
+				d.saveError(&UnmarshalTypeError{"bool", v.Type(), int64(d.off)})
+			}
+		}
+	case 22, 23:
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+			// otherwise, ignore null for primitives/string
+		}
+	case 25, 26, 27:
+		d.storeFloat(v, decodeFloat(info, arg))
+	default:
+		d.saveError(&UnmarshalTypeError{"simple value " + strconv.FormatUint(arg, 10), v.Type(), int64(d.off)})
+	}
+}
+
+// decodeFloat returns the value of an IEEE 754 float of the size
+// indicated by additional information info.
+func decodeFloat(info byte, arg uint64) float64 {
+	switch info {
+	case 25:
+		return float16Value(uint16(arg))
+	case 26:
+		return float64(math.Float32frombits(uint32(arg)))
+	}
+	return math.Float64frombits(arg)
+}
+
+// float16Value returns the value of IEEE 754 binary16 bits h.
+func float16Value(h uint16) float64 {
+	exp := int(h>>10) & 0x1F
+	mant := float64(h & 0x3FF)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1F:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// The xxxInterface routines build up a value to be stored
+// in an empty interface. They are not strictly necessary,
+// but they avoid the weight of reflection in this common case.
+
+// valueInterface is like value but returns interface{}
+func (d *decodeState) valueInterface() interface{} {
+	major, info, arg, err := d.head()
+	if err != nil {
+		d.error(err)
+	}
+	switch major {
+	case majorUint:
+		return intInterface(new(big.Int).SetUint64(arg))
+	case majorNegInt:
+		n := new(big.Int).SetUint64(arg)
+		return intInterface(n.Not(n))
+	case majorBytes:
+		b := append([]byte{}, d.data[d.off:d.off+int(arg)]...)
+		d.off += int(arg)
+		return b
+	case majorText:
+		s := string(d.data[d.off : d.off+int(arg)])
+		d.off += int(arg)
+		return s
+	case majorArray:
+		v := make([]interface{}, 0, int(arg))
+		for i := uint64(0); i < arg; i++ {
+			v = append(v, d.valueInterface())
+		}
+		return v
+	case majorMap:
+		m := make(map[string]interface{}, int(arg))
+		for i := uint64(0); i < arg; i++ {
+			key := string(d.key())
+			m[key] = d.valueInterface()
+		}
+		return m
+	case majorTag:
+		return d.tagInterface(arg)
+	}
+	switch info {
+	case 20, 21:
+		return info == 21
+	case 22, 23:
+		return nil
+	case 25, 26, 27:
+		return decodeFloat(info, arg)
+	}
+	d.saveError(d.syntaxError("unsupported simple value " + strconv.FormatUint(arg, 10)))
+	return nil
+}
+
+// tagInterface is like tag but returns interface{}.
+func (d *decodeState) tagInterface(n uint64) interface{} {
+	switch n {
+	case tagPosBignum, tagNegBignum:
+		x := d.valueInterface()
+		b, ok := x.([]byte)
+		if !ok {
+			d.error(d.syntaxError("bignum content is not a byte string"))
+		}
+		i := new(big.Int).SetBytes(b)
+		if n == tagNegBignum {
+			i.Not(i)
+		}
+		return intInterface(i)
+	case tagDecimalFraction:
+		x, ok := d.valueInterface().([]interface{})
+		if !ok || len(x) != 2 {
+			d.error(d.syntaxError("decimal fraction content is not an array of two integers"))
+		}
+		exp, ok1 := x[0].(int64)
+		mant, ok2 := integerText(x[1])
+		if !ok1 || !ok2 {
+			d.error(d.syntaxError("decimal fraction content is not an array of two integers"))
+		}
+		if exp > maxExponent || exp < -maxExponent {
+			d.error(d.syntaxError("decimal fraction exponent out of range"))
+		}
+		return canonicaljson.Number(mant + "E" + strconv.FormatInt(exp, 10))
+	}
+	return d.valueInterface()
+}
+
+// integerText returns the decimal text of an integer produced by
+// intInterface.
+func integerText(x interface{}) (string, bool) {
+	switch x := x.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10), true
+	case uint64:
+		return strconv.FormatUint(x, 10), true
+	case canonicaljson.Number:
+		return string(x), true
+	}
+	return "", false
+}
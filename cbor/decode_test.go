@@ -0,0 +1,230 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+var decodeTests = []struct {
+	in  string
+	ptr interface{}
+	out interface{}
+}{
+	{"00", new(interface{}), int64(0)},
+	{"1bffffffffffffffff", new(interface{}), uint64(18446744073709551615)},
+	{"3bffffffffffffffff", new(interface{}), canonicaljson.Number("-18446744073709551616")},
+	{"c249010000000000000000", new(interface{}), canonicaljson.Number("18446744073709551616")},
+	{"c249010000000000000000", new(canonicaljson.Number), canonicaljson.Number("18446744073709551616")},
+	{"c48221196ab3", new(interface{}), canonicaljson.Number("27315E-2")},
+	{"c48221196ab3", new(float64), 273.15},
+	{"3903e7", new(int16), int16(-1000)},
+	{"1864", new(uint8), uint8(100)},
+	{"1864", new(float32), float32(100)},
+	{"f93e00", new(interface{}), 1.5},
+	{"f90001", new(float64), 5.960464477539063e-8},
+	{"f97c00", new(interface{}), math.Inf(1)},
+	{"fa47c35000", new(float64), 100000.0},
+	{"fb3ff199999999999a", new(float64), 1.1},
+	{"f4", new(bool), false},
+	{"f5", new(interface{}), true},
+	{"f6", new(interface{}), nil},
+	{"f7", new(*int), (*int)(nil)},
+	{"4401020304", new([]byte), []byte{1, 2, 3, 4}},
+	{"6449455446", new(string), "IETF"},
+	{"64f0908591", new(interface{}), "\U00010151"},
+	{"8301820203820405", new(interface{}),
+		[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"83010203", new([2]int), [2]int{1, 2}},
+	{"81f6", new([]*int), []*int{nil}},
+	{"a26161016162820203", new(map[string]interface{}),
+		map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+
+	// Non-deterministic but well-formed encodings are accepted.
+	{"1900ff", new(int), 255},
+	{"fb3ff8000000000000", new(float64), 1.5},
+	{"c074323031332d30332d32315432303a30343a30305a", new(interface{}), "2013-03-21T20:04:00Z"},
+}
+
+func TestUnmarshal(t *testing.T) {
+	for i, tt := range decodeTests {
+		in, err := hex.DecodeString(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Unmarshal(in, tt.ptr); err != nil {
+			t.Errorf("#%d: Unmarshal(%s): %v", i, tt.in, err)
+			continue
+		}
+		if got := reflect.ValueOf(tt.ptr).Elem().Interface(); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("#%d: Unmarshal(%s) = %#v, want %#v", i, tt.in, got, tt.out)
+		}
+	}
+}
+
+type roundTrip struct {
+	fieldsStruct
+	Time   time.Time
+	Bytes  []byte
+	Raw    canonicaljson.RawMessage
+	Number canonicaljson.Number
+	Map    map[string][]float64
+}
+
+func TestRoundTrip(t *testing.T) {
+	s := "ptr"
+	in := roundTrip{
+		fieldsStruct: fieldsStruct{embedded{1, "z"}, "x", 2, 3, 0, -42, &s, [1]int{7}},
+		Time:         time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC),
+		Bytes:        []byte("bytes"),
+		Raw:          canonicaljson.RawMessage(`{"k":[1,2.5,null]}`),
+		Number:       canonicaljson.Number("1.0E-400"),
+		Map:          map[string][]float64{"a": {1, 0.5}, "bb": nil},
+	}
+	b, err := Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out roundTrip
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Number != "1E-400" {
+		t.Errorf("Number: got %q, want %q", out.Number, "1E-400")
+	}
+	out.Number = in.Number
+	if string(out.Raw) != `{"k":[1,2.5E0,null]}` {
+		t.Errorf("Raw: got %s, want %s", out.Raw, `{"k":[1,2.5E0,null]}`)
+	}
+	out.Raw = in.Raw
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\n got: %#v\nwant: %#v", out, in)
+	}
+
+	// Re-encoding is byte-identical.
+	b2, err := Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b2) != string(b) {
+		t.Errorf("re-encoding:\n got: %x\nwant: %x", b2, b)
+	}
+}
+
+func TestInline(t *testing.T) {
+	type inline struct {
+		B     int                    `json:"b"`
+		Extra map[string]interface{} `json:",inline"`
+	}
+	in := inline{B: 1, Extra: map[string]interface{}{"a": "x", "cc": true}}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"a":"x","b":1,"cc":true}
+	want := "a3" + "61616178" + "616201" + "626363f5"
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Marshal(%#v) = %s, want %s", in, got, want)
+	}
+	var out inline
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\n got: %#v\nwant: %#v", out, in)
+	}
+
+	// Keys differing from a field's only in case round-trip through the
+	// map; the exact key of a field is rejected.
+	in.Extra["B"] = "y"
+	b, err = Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = inline{}
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\n got: %#v\nwant: %#v", out, in)
+	}
+	in.Extra["b"] = 2
+	if _, err := Marshal(in); err == nil {
+		t.Errorf("Marshal(%#v): expected error", in)
+	}
+}
+
+func TestUnmarshalCaseInsensitive(t *testing.T) {
+	var v struct{ Field int }
+	if err := Unmarshal([]byte("\xa1\x65field\x07"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Field != 7 {
+		t.Errorf("Field = %d, want 7", v.Field)
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		ptr interface{}
+	}{
+		{"1864", new(string)},
+		{"20", new(uint)},
+		{"190100", new(int8)},
+		{"6161", new(int)},
+		{"80", new(map[string]int)},
+		{"a0", new([]int)},
+	} {
+		in, _ := hex.DecodeString(tt.in)
+		if err := Unmarshal(in, tt.ptr); err == nil {
+			t.Errorf("Unmarshal(%s, %T): expected error", tt.in, tt.ptr)
+		} else if _, ok := err.(*UnmarshalTypeError); !ok {
+			t.Errorf("Unmarshal(%s, %T): got error %T, want *UnmarshalTypeError", tt.in, tt.ptr, err)
+		}
+	}
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"18",
+		"62c3",
+		"62c328",
+		"8201",
+		"a1",
+		"a10101",
+		"5f42010243030405ff",
+		"1c",
+		"f818",
+		"0000",
+		"9bffffffffffffffff",
+		// 1E1000000000 as a decimal fraction.
+		"c4821b000000003b9aca0001",
+		// 1E-1000000000.
+		"c4823a3b9ac9ff01",
+	} {
+		b, _ := hex.DecodeString(in)
+		var v interface{}
+		if err := Unmarshal(b, &v); err == nil {
+			t.Errorf("Unmarshal(%s): expected error", in)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Unmarshal(%s): got error %T, want *SyntaxError", in, err)
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	var v int
+	if err := Unmarshal([]byte{0}, v); err == nil {
+		t.Error("Unmarshal into non-pointer: expected error")
+	}
+}
@@ -0,0 +1,955 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cbor implements serialization of Go objects to CBOR in the
+// "core deterministic" encoding specified by RFC 8949 section 4.2.1.
+//
+// Go values are mapped to CBOR data items using the same rules that
+// package canonicaljson uses to map them to JSON, including resolution of
+// struct fields and their "json" tags, so that the CBOR and canonical JSON
+// encodings of a value describe the same logical document.
+// Differences that follow from the data models:
+//   - Integers encode as CBOR integers (or bignums when they do not fit
+//     in 64 bits) and floating point values as the shortest IEEE 754
+//     float that preserves their value.
+//   - Number values encode as integers when integral and otherwise as
+//     decimal fractions (tag 4), preserving their exact value. Numbers
+//     with a base-10 exponent beyond ±1000000 are rejected in both
+//     directions.
+//   - []byte encodes as a byte string rather than as base64 text.
+//   - Map keys and struct fields are ordered by the bytewise
+//     lexicographic order of their encodings (i.e., shorter keys first).
+//   - Elements of slices and arrays with the "set" option are likewise
+//     ordered by their CBOR encodings.
+package cbor
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gibson042/canonicaljson-go"
+	"github.com/gibson042/canonicaljson-go/internal/fields"
+)
+
+// Marshal returns the deterministic CBOR encoding of v.
+//
+// Marshal traverses v recursively, following the same rules as
+// canonicaljson.Marshal. Values implementing json.Marshaler have their
+// JSON output decoded and re-encoded as CBOR, and values implementing
+// encoding.TextMarshaler encode as text strings.
+// Strings must be valid UTF-8; unlike canonicaljson.Marshal, "WTF-8"
+// lone surrogates cannot be represented and are rejected.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encodeState{}
+	err := e.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// An UnsupportedTypeError is returned by Marshal when attempting
+// to encode an unsupported value type.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "cbor: unsupported type: " + e.Type.String()
+}
+
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "cbor: unsupported value: " + e.Str
+}
+
+// A DuplicateElementError is returned by Marshal for a slice or array with
+// the "set" and "unique" options having elements with the same encoding.
+type DuplicateElementError struct {
+	Type     reflect.Type // type of the slice or array
+	Index    int          // index of the duplicate element
+	First    int          // index of the earlier element it duplicates
+	Encoding string       // hexadecimal encoding of the elements, truncated if long
+}
+
+func (e *DuplicateElementError) Error() string {
+	return "cbor: element " + strconv.Itoa(e.Index) + " of " + e.Type.String() +
+		" duplicates element " + strconv.Itoa(e.First) + ": " + e.Encoding
+}
+
+// maxErrorEncoding is the number of bytes of an encoding beyond which it
+// is truncated in an error.
+const maxErrorEncoding = 32
+
+var errTrailingJSON = errors.New("cbor: invalid character after top-level JSON value")
+
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	return "cbor: error calling MarshalJSON for type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+// CBOR major types.
+const (
+	majorUint   = 0 << 5
+	majorNegInt = 1 << 5
+	majorBytes  = 2 << 5
+	majorText   = 3 << 5
+	majorArray  = 4 << 5
+	majorMap    = 5 << 5
+	majorTag    = 6 << 5
+	majorSimple = 7 << 5
+)
+
+// CBOR tag numbers and simple values.
+const (
+	tagPosBignum       = 2
+	tagNegBignum       = 3
+	tagDecimalFraction = 4
+
+	simpleFalse     = majorSimple | 20
+	simpleTrue      = majorSimple | 21
+	simpleNull      = majorSimple | 22
+	simpleUndefined = majorSimple | 23
+	simpleFloat16   = majorSimple | 25
+	simpleFloat32   = majorSimple | 26
+	simpleFloat64   = majorSimple | 27
+)
+
+// maxExponent bounds the base-10 exponent of a number, whose encoding as
+// an integer (or decimal fraction) otherwise costs time and space that grow
+// with the exponent rather than the length of its literal (as for
+// 1E1000000000). It matches the limit of canonicaljson.Number.BigInt.
+const maxExponent = 1000000
+
+var numberType = reflect.TypeOf(canonicaljson.Number(""))
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// An encodeState encodes CBOR into a bytes.Buffer.
+type encodeState struct {
+	bytes.Buffer // accumulated output
+	scratch      [9]byte
+}
+
+func (e *encodeState) marshal(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			if s, ok := r.(string); ok {
+				panic(s)
+			}
+			err = r.(error)
+		}
+	}()
+	e.reflectValue(reflect.ValueOf(v))
+	return nil
+}
+
+func (e *encodeState) error(err error) {
+	panic(err)
+}
+
+// head writes the initial byte and shortest argument for a data item
+// of the given major type.
+func (e *encodeState) head(major byte, n uint64) {
+	b := e.scratch[:0]
+	switch {
+	case n < 24:
+		b = append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, major|25, 0, 0)
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+	case n <= math.MaxUint32:
+		b = append(b, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+	default:
+		b = append(b, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[1:], n)
+	}
+	e.Write(b)
+}
+
+func (e *encodeState) int(n int64) {
+	if n < 0 {
+		e.head(majorNegInt, uint64(^n))
+	} else {
+		e.head(majorUint, uint64(n))
+	}
+}
+
+func (e *encodeState) bigInt(n *big.Int) {
+	if n.IsUint64() {
+		e.head(majorUint, n.Uint64())
+		return
+	}
+	if n.Sign() < 0 {
+		// -1-n, i.e. the bitwise complement.
+		m := new(big.Int).Not(n)
+		if m.IsUint64() {
+			e.head(majorNegInt, m.Uint64())
+			return
+		}
+		e.head(majorTag, tagNegBignum)
+		e.bytes(m.Bytes())
+		return
+	}
+	e.head(majorTag, tagPosBignum)
+	e.bytes(n.Bytes())
+}
+
+func (e *encodeState) bytes(b []byte) {
+	e.head(majorBytes, uint64(len(b)))
+	e.Write(b)
+}
+
+func (e *encodeState) text(s string) {
+	if !utf8.ValidString(s) {
+		e.error(&UnsupportedValueError{reflect.ValueOf(s), strconv.Quote(s)})
+	}
+	e.head(majorText, uint64(len(s)))
+	e.WriteString(s)
+}
+
+// float writes f using the shortest of the IEEE 754 binary16, binary32,
+// and binary64 formats that preserves its value.
+func (e *encodeState) float(f float64) {
+	if h, ok := float16Bits(f); ok {
+		e.WriteByte(simpleFloat16)
+		binary.BigEndian.PutUint16(e.scratch[:2], h)
+		e.Write(e.scratch[:2])
+	} else if f32 := float32(f); float64(f32) == f {
+		e.WriteByte(simpleFloat32)
+		binary.BigEndian.PutUint32(e.scratch[:4], math.Float32bits(f32))
+		e.Write(e.scratch[:4])
+	} else {
+		e.WriteByte(simpleFloat64)
+		binary.BigEndian.PutUint64(e.scratch[:8], math.Float64bits(f))
+		e.Write(e.scratch[:8])
+	}
+}
+
+// float16Bits returns the IEEE 754 binary16 representation of finite f
+// and true, or false if f cannot be represented exactly in that format.
+func float16Bits(f float64) (uint16, bool) {
+	bits := math.Float64bits(f)
+	sign := uint16(bits>>48) & 0x8000
+	exp := int(bits>>52&0x7FF) - 1023
+	mant := bits & (1<<52 - 1)
+	switch {
+	case f == 0:
+		return sign, true
+	case exp >= -14 && exp <= 15:
+		// Normal: 10 explicit significand bits.
+		if mant&(1<<42-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>42), true
+	case exp >= -24 && exp < -14:
+		// Subnormal: value is (significand with implicit bit) >> shift.
+		shift := uint(42 + -14 - exp)
+		full := mant | 1<<52
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
+
+// number writes the exact value of the valid JSON number literal s.
+func (e *encodeState) number(v reflect.Value, s string) {
+	mant, exp, ok := parseDecimal(s)
+	if !ok {
+		e.error(&UnsupportedValueError{v, "invalid number literal " + strconv.Quote(s)})
+	}
+	if exp > maxExponent || exp < -maxExponent {
+		e.error(&UnsupportedValueError{v, "number exponent out of range"})
+	}
+	if exp >= 0 {
+		if exp > 0 {
+			mant.Mul(mant, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+		}
+		e.bigInt(mant)
+		return
+	}
+	e.head(majorTag, tagDecimalFraction)
+	e.head(majorArray, 2)
+	e.int(int64(exp))
+	e.bigInt(mant)
+}
+
+// parseDecimal parses the JSON number literal s into an integer mantissa
+// without trailing zeroes and a base-10 exponent. An exponent part beyond
+// maxExponent is clamped (so that adjusting it cannot overflow) to a value
+// that leaves the result out of range.
+func parseDecimal(s string) (mant *big.Int, exp int, ok bool) {
+	if !isValidNumber(s) {
+		return nil, 0, false
+	}
+	negative := s[0] == '-'
+	if negative {
+		s = s[1:]
+	}
+	digits := s
+	if i := indexAny(s, "eE"); i >= 0 {
+		digits = s[:i]
+		e, err := strconv.Atoi(s[i+1:])
+		switch {
+		case e > maxExponent:
+			e = maxExponent + len(s)
+		case e < -maxExponent:
+			e = -maxExponent - len(s)
+		case err != nil:
+			return nil, 0, false
+		}
+		exp = e
+	}
+	if i := indexAny(digits, "."); i >= 0 {
+		exp -= len(digits) - i - 1
+		digits = digits[:i] + digits[i+1:]
+	}
+	for len(digits) > 1 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+		exp++
+	}
+	mant, ok = new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, 0, false
+	}
+	if mant.Sign() == 0 {
+		exp = 0
+	}
+	if negative {
+		mant.Neg(mant)
+	}
+	return mant, exp, true
+}
+
+func indexAny(s, chars string) int {
+	for i := 0; i < len(s); i++ {
+		for j := 0; j < len(chars); j++ {
+			if s[i] == chars[j] {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isValidNumber reports whether s is a valid JSON number literal.
+func isValidNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+	switch {
+	default:
+		return false
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	return s == ""
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (e *encodeState) reflectValue(v reflect.Value) {
+	valueEncoder(v)(e, v, false)
+}
+
+type encoderFunc func(e *encodeState, v reflect.Value, quoted bool)
+
+// encoderCache maps types to their encoderFuncs. Reads are lock-free;
+// writers copy the map under mu and store the copy.
+var encoderCache struct {
+	value atomic.Value // map[reflect.Type]encoderFunc
+	mu    sync.Mutex   // used only by writers
+}
+
+// cacheEncoder stores f as the encoderFunc for t.
+func cacheEncoder(t reflect.Type, f encoderFunc) {
+	encoderCache.mu.Lock()
+	m, _ := encoderCache.value.Load().(map[reflect.Type]encoderFunc)
+	newM := make(map[reflect.Type]encoderFunc, len(m)+1)
+	for k, v := range m {
+		newM[k] = v
+	}
+	newM[t] = f
+	encoderCache.value.Store(newM)
+	encoderCache.mu.Unlock()
+}
+
+func valueEncoder(v reflect.Value) encoderFunc {
+	if !v.IsValid() {
+		return invalidValueEncoder
+	}
+	return typeEncoder(v.Type())
+}
+
+func typeEncoder(t reflect.Type) encoderFunc {
+	m, _ := encoderCache.value.Load().(map[reflect.Type]encoderFunc)
+	f := m[t]
+	if f != nil {
+		return f
+	}
+
+	// To deal with recursive types, populate the map with an
+	// indirect func before we build it. This type waits on the
+	// real func (f) to be ready and then calls it. This indirect
+	// func is only used for recursive types.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	cacheEncoder(t, func(e *encodeState, v reflect.Value, quoted bool) {
+		wg.Wait()
+		f(e, v, quoted)
+	})
+
+	// Compute fields without lock.
+	// Might duplicate effort but won't hold other computations back.
+	f = newTypeEncoder(t, true)
+	wg.Done()
+	cacheEncoder(t, f)
+	return f
+}
+
+var (
+	marshalerType     = reflect.TypeOf(new(json.Marshaler)).Elem()
+	textMarshalerType = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+)
+
+// newTypeEncoder constructs an encoderFunc for a type.
+// The returned encoder only checks CanAddr when allowAddr is true.
+func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	if t.Implements(marshalerType) {
+		return marshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(marshalerType) {
+			return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
+		}
+	}
+
+	if t.Implements(textMarshalerType) {
+		return textMarshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(textMarshalerType) {
+			return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolEncoder
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intEncoder
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uintEncoder
+	case reflect.Float32:
+		return float32Encoder
+	case reflect.Float64:
+		return float64Encoder
+	case reflect.String:
+		return stringEncoder
+	case reflect.Interface:
+		return interfaceEncoder
+	case reflect.Struct:
+		return newStructEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Slice:
+		return newSliceEncoder(t)
+	case reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	default:
+		return unsupportedTypeEncoder
+	}
+}
+
+func invalidValueEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	e.WriteByte(simpleNull)
+}
+
+func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	e.marshalJSON(v, v.Interface().(json.Marshaler))
+}
+
+func addrMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	e.marshalJSON(v, va.Interface().(json.Marshaler))
+}
+
+// marshalJSON encodes the JSON output of m, preserving its numbers exactly.
+func (e *encodeState) marshalJSON(v reflect.Value, m json.Marshaler) {
+	b, err := m.MarshalJSON()
+	var data interface{}
+	if err == nil {
+		dec := canonicaljson.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&data)
+		if err == nil {
+			if _, terr := dec.Token(); terr != io.EOF {
+				err = errTrailingJSON
+			}
+		}
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err})
+	}
+	e.reflectValue(reflect.ValueOf(data))
+}
+
+func textMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	m := v.Interface().(encoding.TextMarshaler)
+	b, err := m.MarshalText()
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err})
+	}
+	e.text(string(b))
+}
+
+func addrTextMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	m := va.Interface().(encoding.TextMarshaler)
+	b, err := m.MarshalText()
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err})
+	}
+	e.text(string(b))
+}
+
+// The encoders below write quoted values (from the ",string" struct tag
+// option) as text strings holding the same JSON text that
+// canonicaljson.Marshal would quote.
+
+func boolEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if quoted {
+		e.text(strconv.FormatBool(v.Bool()))
+	} else if v.Bool() {
+		e.WriteByte(simpleTrue)
+	} else {
+		e.WriteByte(simpleFalse)
+	}
+}
+
+func intEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if quoted {
+		e.text(strconv.FormatInt(v.Int(), 10))
+	} else {
+		e.int(v.Int())
+	}
+}
+
+func uintEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if quoted {
+		e.text(strconv.FormatUint(v.Uint(), 10))
+	} else {
+		e.head(majorUint, v.Uint())
+	}
+}
+
+type floatEncoder int // number of bits
+
+func (bits floatEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
+	// Get a float value *not* equal to negative zero.
+	f := v.Float() + 0
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		e.error(&UnsupportedValueError{v, strconv.FormatFloat(f, 'g', -1, int(bits))})
+	}
+	if quoted {
+		e.text(strconv.FormatFloat(f, 'E', -1, int(bits)))
+	} else {
+		e.float(f)
+	}
+}
+
+var (
+	float32Encoder = (floatEncoder(32)).encode
+	float64Encoder = (floatEncoder(64)).encode
+)
+
+func stringEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if t := v.Type(); t == numberType || t == jsonNumberType {
+		e.number(v, v.String())
+		return
+	}
+	if quoted {
+		sb, err := canonicaljson.Marshal(v.String())
+		if err != nil {
+			e.error(err)
+		}
+		e.text(string(sb))
+	} else {
+		e.text(v.String())
+	}
+}
+
+func interfaceEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	e.reflectValue(v.Elem())
+}
+
+func unsupportedTypeEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	e.error(&UnsupportedTypeError{v.Type()})
+}
+
+// keyLess reports whether text string key a sorts before key b in the
+// bytewise lexicographic order of their CBOR encodings, which for text
+// strings is shortest first and then bytewise.
+func keyLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+type structEncoder struct {
+	fields    []fields.Field
+	fieldEncs []encoderFunc
+	inline    *fields.Field // the ",inline" field, if any
+	inlineEnc encoderFunc   // encoder for the elements of inline
+}
+
+func (se *structEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
+	// Members of an inline map are merged with the other fields in
+	// sorted order, so long as none of them would decode into a field.
+	// Each is copied into an addressable elem first, so that e.g. a
+	// RawMessage member is not mistaken for a []byte.
+	var extra, elem reflect.Value
+	var keys []reflect.Value
+	if se.inline != nil {
+		extra = fields.FieldByIndex(v, se.inline.Index)
+		if extra.IsValid() && extra.Len() > 0 {
+			elem = reflect.New(extra.Type().Elem()).Elem()
+			keys = extra.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return keyLess(keys[i].String(), keys[j].String())
+			})
+			for _, k := range keys {
+				if fields.LookupExact(se.fields, []byte(k.String())) != nil {
+					e.error(&UnsupportedValueError{extra, "inline member " + strconv.Quote(k.String()) + " collides with a struct field"})
+				}
+			}
+		}
+	}
+
+	// Count members before writing the definite-length header.
+	fvs := make([]reflect.Value, len(se.fields))
+	n := len(keys)
+	for i, f := range se.fields {
+		if f.Inline {
+			continue
+		}
+		fv := fields.FieldByIndex(v, f.Index)
+		if !fv.IsValid() || f.OmitEmpty && isEmptyValue(fv) || f.OmitZero && f.IsZero(fv) {
+			continue
+		}
+		fvs[i] = fv
+		n++
+	}
+	e.head(majorMap, uint64(n))
+	for i, f := range se.fields {
+		if !fvs[i].IsValid() {
+			continue
+		}
+		for ; len(keys) > 0 && keyLess(keys[0].String(), f.Name); keys = keys[1:] {
+			e.text(keys[0].String())
+			elem.Set(extra.MapIndex(keys[0]))
+			se.inlineEnc(e, elem, false)
+		}
+		e.text(f.Name)
+		se.fieldEncs[i](e, fvs[i], f.Quoted)
+	}
+	for _, k := range keys {
+		e.text(k.String())
+		elem.Set(extra.MapIndex(k))
+		se.inlineEnc(e, elem, false)
+	}
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	fs := fields.CachedTypeFields(t)
+	se := &structEncoder{
+		fields:    make([]fields.Field, len(fs)),
+		fieldEncs: make([]encoderFunc, len(fs)),
+	}
+	copy(se.fields, fs)
+	sort.Slice(se.fields, func(i, j int) bool {
+		return keyLess(se.fields[i].Name, se.fields[j].Name)
+	})
+	se.inline = fields.Inline(se.fields)
+	for i, f := range se.fields {
+		if f.Inline {
+			se.inlineEnc = typeEncoder(f.Type.Elem())
+			continue
+		}
+		if f.Set {
+			se.fieldEncs[i] = newSetEncoder(f.Type, f.Unique)
+			continue
+		}
+		se.fieldEncs[i] = typeEncoder(fields.TypeByIndex(t, f.Index))
+	}
+	return se.encode
+}
+
+type mapEncoder struct {
+	elemEnc encoderFunc
+}
+
+func (me *mapEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
+	if v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i].String(), keys[j].String())
+	})
+	e.head(majorMap, uint64(len(keys)))
+	for _, k := range keys {
+		e.text(k.String())
+		me.elemEnc(e, v.MapIndex(k), false)
+	}
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	if t.Key().Kind() != reflect.String {
+		return unsupportedTypeEncoder
+	}
+	me := &mapEncoder{typeEncoder(t.Elem())}
+	return me.encode
+}
+
+func encodeByteSlice(e *encodeState, v reflect.Value, _ bool) {
+	if v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	e.bytes(v.Bytes())
+}
+
+// sliceEncoder just wraps an arrayEncoder, checking to make sure the value isn't nil.
+type sliceEncoder struct {
+	arrayEnc encoderFunc
+}
+
+func (se *sliceEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
+	if v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	se.arrayEnc(e, v, false)
+}
+
+func newSliceEncoder(t reflect.Type) encoderFunc {
+	// Byte slices get special treatment; arrays don't.
+	if t.Elem().Kind() == reflect.Uint8 {
+		return encodeByteSlice
+	}
+	enc := &sliceEncoder{newArrayEncoder(t)}
+	return enc.encode
+}
+
+type arrayEncoder struct {
+	elemEnc encoderFunc
+}
+
+func (ae *arrayEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
+	n := v.Len()
+	e.head(majorArray, uint64(n))
+	for i := 0; i < n; i++ {
+		ae.elemEnc(e, v.Index(i), false)
+	}
+}
+
+func newArrayEncoder(t reflect.Type) encoderFunc {
+	enc := &arrayEncoder{typeEncoder(t.Elem())}
+	return enc.encode
+}
+
+// setEncoder encodes a slice or array with the "set" option as a CBOR array
+// with its elements sorted by their encodings.
+type setEncoder struct {
+	elemEnc encoderFunc
+	unique  bool // whether to reject duplicate elements
+}
+
+// A setElem is the encoding of the element of a set at index.
+type setElem struct {
+	enc   []byte
+	index int
+}
+
+func (se *setEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+
+	// Encode each element in place, then move it aside. Equal encodings
+	// stay in index order, so that a duplicate follows its first instance.
+	n := v.Len()
+	elems := make([]setElem, n)
+	start := e.Len()
+	for i := 0; i < n; i++ {
+		se.elemEnc(e, v.Index(i), false)
+		elems[i] = setElem{append([]byte(nil), e.Bytes()[start:]...), i}
+		e.Truncate(start)
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		c := bytes.Compare(elems[i].enc, elems[j].enc)
+		return c < 0 || c == 0 && elems[i].index < elems[j].index
+	})
+
+	e.head(majorArray, uint64(n))
+	for i, elem := range elems {
+		if i > 0 && se.unique && bytes.Equal(elem.enc, elems[i-1].enc) {
+			enc := hex.EncodeToString(elem.enc)
+			if len(elem.enc) > maxErrorEncoding {
+				enc = hex.EncodeToString(elem.enc[:maxErrorEncoding]) + "..."
+			}
+			e.error(&DuplicateElementError{v.Type(), elem.index, elems[i-1].index, enc})
+		}
+		e.Write(elem.enc)
+	}
+}
+
+func newSetEncoder(t reflect.Type, unique bool) encoderFunc {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return typeEncoder(t)
+	}
+	for _, iface := range []reflect.Type{marshalerType, textMarshalerType} {
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			return typeEncoder(t)
+		}
+	}
+	se := &setEncoder{typeEncoder(t.Elem()), unique}
+	return se.encode
+}
+
+type ptrEncoder struct {
+	elemEnc encoderFunc
+}
+
+func (pe *ptrEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
+	if v.IsNil() {
+		e.WriteByte(simpleNull)
+		return
+	}
+	pe.elemEnc(e, v.Elem(), quoted)
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	enc := &ptrEncoder{typeEncoder(t.Elem())}
+	return enc.encode
+}
+
+type condAddrEncoder struct {
+	canAddrEnc, elseEnc encoderFunc
+}
+
+func (ce *condAddrEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
+	if v.CanAddr() {
+		ce.canAddrEnc(e, v, quoted)
+	} else {
+		ce.elseEnc(e, v, quoted)
+	}
+}
+
+// newCondAddrEncoder returns an encoder that checks whether its value
+// CanAddr and delegates to canAddrEnc if so, else to elseEnc.
+func newCondAddrEncoder(canAddrEnc, elseEnc encoderFunc) encoderFunc {
+	enc := &condAddrEncoder{canAddrEnc: canAddrEnc, elseEnc: elseEnc}
+	return enc.encode
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+// Examples from RFC 8949 Appendix A, restricted to those that are
+// deterministically encoded and expressible as Go values.
+var encodeTests = []struct {
+	in  interface{}
+	out string
+}{
+	{0, "00"},
+	{1, "01"},
+	{10, "0a"},
+	{23, "17"},
+	{24, "1818"},
+	{25, "1819"},
+	{100, "1864"},
+	{1000, "1903e8"},
+	{1000000, "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{uint64(18446744073709551615), "1bffffffffffffffff"},
+	{canonicaljson.Number("18446744073709551616"), "c249010000000000000000"},
+	{canonicaljson.Number("-18446744073709551616"), "3bffffffffffffffff"},
+	{canonicaljson.Number("-18446744073709551617"), "c349010000000000000000"},
+	{-1, "20"},
+	{-10, "29"},
+	{-100, "3863"},
+	{-1000, "3903e7"},
+	{0.0, "f90000"},
+	{math.Copysign(0, -1), "f90000"},
+	{1.0, "f93c00"},
+	{1.1, "fb3ff199999999999a"},
+	{1.5, "f93e00"},
+	{65504.0, "f97bff"},
+	{100000.0, "fa47c35000"},
+	{3.4028234663852886e+38, "fa7f7fffff"},
+	{1.0e+300, "fb7e37e43c8800759c"},
+	{5.960464477539063e-8, "f90001"},
+	{0.00006103515625, "f90400"},
+	{-4.0, "f9c400"},
+	{-4.1, "fbc010666666666666"},
+	{float32(0.1), "fa3dcccccd"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{[]byte{}, "40"},
+	{[]byte{1, 2, 3, 4}, "4401020304"},
+	{"", "60"},
+	{"a", "6161"},
+	{"IETF", "6449455446"},
+	{"\"\\", "62225c"},
+	{"ü", "62c3bc"},
+	{"水", "63e6b0b4"},
+	{"\U00010151", "64f0908591"},
+	{[]int{}, "80"},
+	{[]int{1, 2, 3}, "83010203"},
+	{[]interface{}{1, []int{2, 3}, [2]int{4, 5}}, "8301820203820405"},
+	{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25},
+		"98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+	{map[string]int{}, "a0"},
+	{map[string]interface{}{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+	{[]interface{}{"a", map[string]string{"b": "c"}}, "826161a161626163"},
+	{map[string]string{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"},
+		"a56161614161626142616361436164614461656145"},
+
+	// Keys sort shortest first.
+	{map[string]int{"bb": 1, "a": 2, "ab": 3, "c": 4}, "a461610261630462616203626262" + "01"},
+
+	// Numbers.
+	{canonicaljson.Number("273.15"), "c48221196ab3"},
+	{json.Number("1.5E0"), "c482200f"},
+	{canonicaljson.Number("1.50"), "c482200f"},
+	{canonicaljson.Number("1E2"), "1864"},
+	{canonicaljson.Number("-0.0"), "00"},
+
+	// Nil values.
+	{[]int(nil), "f6"},
+	{map[string]int(nil), "f6"},
+	{(*int)(nil), "f6"},
+}
+
+func TestMarshal(t *testing.T) {
+	for i, tt := range encodeTests {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("#%d: Marshal(%#v): %v", i, tt.in, err)
+			continue
+		}
+		if got := hex.EncodeToString(b); got != tt.out {
+			t.Errorf("#%d: Marshal(%#v) = %s, want %s", i, tt.in, got, tt.out)
+		}
+	}
+}
+
+type embedded struct {
+	Q int `json:"q"`
+	Z string
+}
+
+type fieldsStruct struct {
+	embedded
+	Long   string  `json:"longer"`
+	A      int     `json:"a"`
+	Omit   int     `json:"o,omitempty"`
+	Skip   int     `json:"-"`
+	Quoted int64   `json:"s,string"`
+	Ptr    *string `json:"p"`
+	Zero   [1]int  `json:"z,omitzero"`
+}
+
+func TestMarshalStruct(t *testing.T) {
+	v := fieldsStruct{embedded{1, "z"}, "x", 2, 0, 9, 42, nil, [1]int{}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"Z":"z","a":2,"p":null,"q":1,"s":"42","longer":"x"}
+	want := "a6" + "615a617a" + "616102" + "6170f6" + "617101" + "6173623432" + "666c6f6e676572" + "6178"
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Marshal(%#v) = %s, want %s", v, got, want)
+	}
+}
+
+func TestMarshalSet(t *testing.T) {
+	v := struct {
+		Set    []interface{} `json:"s,set"`
+		Unique []int         `json:"u,set,unique"`
+	}{[]interface{}{"aa", 10, "b", -1}, []int{2, 1}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"s":[10,-1,"b","aa"],"u":[1,2]}
+	want := "a2" + "6173" + "84" + "0a" + "20" + "6162" + "626161" + "6175" + "82" + "01" + "02"
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Marshal(%#v) = %s, want %s", v, got, want)
+	}
+
+	v.Unique = append(v.Unique, 1)
+	_, err = Marshal(v)
+	if derr, ok := err.(*DuplicateElementError); !ok || derr.Index != 2 || derr.First != 1 || derr.Encoding != "01" {
+		t.Errorf("Marshal(%#v): got error %#v, want *DuplicateElementError", v, err)
+	}
+}
+
+type jsonMarshaler struct{}
+
+func (jsonMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{"n": 0.10, "s": ["x"]}`), nil
+}
+
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{} {}`), nil
+}
+
+func TestMarshalMarshaler(t *testing.T) {
+	b, err := Marshal(jsonMarshaler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a2" + "616e" + "c4822001" + "6173" + "816178"
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("Marshal(jsonMarshaler{}) = %s, want %s", got, want)
+	}
+
+	if _, err := Marshal(badMarshaler{}); err == nil {
+		t.Error("Marshal(badMarshaler{}): expected error")
+	} else if _, ok := err.(*MarshalerError); !ok {
+		t.Errorf("Marshal(badMarshaler{}): got error %T, want *MarshalerError", err)
+	}
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	for _, v := range []interface{}{
+		math.NaN(),
+		math.Inf(1),
+		"\xed\xa0\x80",
+		make(chan int),
+		map[int]int{},
+		canonicaljson.Number("01"),
+		canonicaljson.Number("1e100000000"),
+		canonicaljson.Number("1E1000000000"),
+		canonicaljson.Number("-1.5e-99999999999999999999"),
+	} {
+		if b, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(%#v) = %x, want error", v, b)
+		}
+	}
+}
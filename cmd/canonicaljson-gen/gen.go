@@ -0,0 +1,862 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gibson042/canonicaljson-go"
+	"github.com/gibson042/canonicaljson-go/internal/fields"
+)
+
+const canonicaljsonPath = "github.com/gibson042/canonicaljson-go"
+
+// generate returns the source of a file declaring canonical JSON methods
+// for the named struct types of the package in dir, ignoring any existing
+// file named exclude.
+func generate(dir, exclude string, names []string) ([]byte, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == exclude {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(bp.ImportPath, fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{pkg: pkg, types: map[*types.Named]*structType{}}
+	var sts []*structType
+	for _, name := range names {
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			return nil, fmt.Errorf("type %s not found in %s", name, dir)
+		}
+		named, ok := types.Unalias(obj.Type()).(*types.Named)
+		if _, isTypeName := obj.(*types.TypeName); !ok || !isTypeName {
+			return nil, fmt.Errorf("%s is not a named type", name)
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		}
+		if g.types[named] != nil {
+			continue
+		}
+		st := &structType{named: named, fields: structFields(named)}
+		for _, f := range st.fields {
+			if f.inline || f.set {
+				return nil, fmt.Errorf("%s has a field with the inline or set option, which is not supported", name)
+			}
+		}
+		g.types[named] = st
+		sts = append(sts, st)
+	}
+
+	// A type whose encoding depends on addressability needs a pointer
+	// receiver, which can in turn affect types that contain it.
+	for changed := true; changed; {
+		changed = false
+		for _, st := range sts {
+			if !st.addr && g.appendBody(st, false) != g.appendBody(st, true) {
+				st.addr = true
+				changed = true
+			}
+		}
+	}
+
+	g.imports = nil
+	var body bytes.Buffer
+	for _, st := range sts {
+		g.writeMethods(&body, st)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by canonicaljson-gen -type=%s; DO NOT EDIT.\n\n", strings.Join(names, ","))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg.Name())
+	buf.WriteString("import (\n")
+	var std, other []string
+	for path := range g.imports {
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	for i, group := range [][]string{std, other} {
+		if i > 0 && len(std) > 0 && len(group) > 0 {
+			buf.WriteString("\n")
+		}
+		sort.Strings(group)
+		for _, path := range group {
+			if name := g.imports[path]; name != importedName(path) {
+				fmt.Fprintf(&buf, "\t%s %q\n", name, path)
+			} else {
+				fmt.Fprintf(&buf, "\t%q\n", path)
+			}
+		}
+	}
+	buf.WriteString(")\n")
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+// importedName returns the default name of the package at path, which
+// for the packages imported by generated code is its last element.
+func importedName(path string) string {
+	if path == canonicaljsonPath {
+		return "canonicaljson"
+	}
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// A structType is a struct type for which methods are generated.
+type structType struct {
+	named  *types.Named
+	fields []field
+	addr   bool // whether AppendCanonicalJSON needs a pointer receiver
+}
+
+// A field mirrors fields.Field for a struct type found in source.
+type field struct {
+	name      string
+	tag       bool
+	index     []int
+	path      []*types.Var // struct fields selected by index
+	typ       types.Type   // field type, with an unnamed pointer followed
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+	set       bool
+	inline    bool
+}
+
+// structFields returns the fields that JSON should recognize for the given
+// struct type, sorted by name. It follows fields.typeFields exactly, so
+// that generated code matches the reflective encoder.
+func structFields(t types.Type) []field {
+	// Anonymous fields to explore at the current level and the next.
+	current := []field{}
+	next := []field{{typ: t}}
+
+	// Count of queued names for current level and the next.
+	count := map[types.Type]int{}
+	nextCount := map[types.Type]int{}
+
+	// Types already visited at an earlier level.
+	visited := map[types.Type]bool{}
+
+	// Fields found.
+	var fs []field
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[types.Type]int{}
+
+		for _, f := range current {
+			if visited[f.typ] {
+				continue
+			}
+			visited[f.typ] = true
+
+			// Scan f.typ for fields to include.
+			st := f.typ.Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				sf := st.Field(i)
+				if !sf.Exported() && !sf.Embedded() { // unexported
+					continue
+				}
+				tag := reflect.StructTag(st.Tag(i)).Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := fields.ParseTag(tag)
+				if !fields.IsValidTag(name) {
+					name = ""
+				}
+				index := append(append([]int(nil), f.index...), i)
+				path := append(append([]*types.Var(nil), f.path...), sf)
+
+				ft := types.Unalias(sf.Type())
+				if p, ok := ft.(*types.Pointer); ok {
+					// Follow pointer.
+					ft = types.Unalias(p.Elem())
+				}
+
+				// Only strings, floats, integers, and booleans can be quoted.
+				quoted := false
+				if opts.Contains("string") {
+					if b, ok := ft.Underlying().(*types.Basic); ok {
+						switch b.Kind() {
+						case types.Bool,
+							types.Int, types.Int8, types.Int16, types.Int32, types.Int64,
+							types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64,
+							types.Float32, types.Float64,
+							types.String:
+							quoted = true
+						}
+					}
+				}
+
+				// Only slices and arrays (but not byte slices) can be sets.
+				set := false
+				if opts.Contains("set") {
+					switch u := types.Unalias(sf.Type()).Underlying().(type) {
+					case *types.Slice:
+						b, ok := u.Elem().Underlying().(*types.Basic)
+						set = !ok || b.Kind() != types.Uint8
+					case *types.Array:
+						set = true
+					}
+				}
+
+				// Record a map field with the ",inline" option under an
+				// empty name, which no other field can have.
+				if m, ok := types.Unalias(sf.Type()).Underlying().(*types.Map); ok && opts.Contains("inline") {
+					if k, ok := m.Key().Underlying().(*types.Basic); ok && k.Kind() == types.String {
+						fs = append(fs, field{index: index, path: path, typ: sf.Type(), inline: true})
+						if count[f.typ] > 1 {
+							fs = append(fs, fs[len(fs)-1])
+						}
+						continue
+					}
+				}
+
+				// Record found field and index sequence.
+				_, isStruct := ft.Underlying().(*types.Struct)
+				if name != "" || !sf.Embedded() || !isStruct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name()
+					}
+					fs = append(fs, field{
+						name:      name,
+						tag:       tagged,
+						index:     index,
+						path:      path,
+						typ:       ft,
+						omitEmpty: opts.Contains("omitempty"),
+						omitZero:  opts.Contains("omitzero"),
+						quoted:    quoted,
+						set:       set,
+					})
+					if count[f.typ] > 1 {
+						// If there were multiple instances, add a second,
+						// so that the annihilation code will see a duplicate.
+						fs = append(fs, fs[len(fs)-1])
+					}
+					continue
+				}
+
+				// Record new anonymous struct to explore in next round.
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, field{index: index, path: path, typ: ft})
+				}
+			}
+		}
+	}
+
+	sort.Sort(byName(fs))
+
+	// Delete all fields that are hidden by the Go rules for embedded fields,
+	// except that fields with JSON tags are promoted.
+	out := fs[:0]
+	for advance, i := 0, 0; i < len(fs); i += advance {
+		// One iteration per name.
+		fi := fs[i]
+		for advance = 1; i+advance < len(fs); advance++ {
+			if fs[i+advance].name != fi.name {
+				break
+			}
+		}
+		if advance == 1 { // Only one field with this name
+			out = append(out, fi)
+			continue
+		}
+		if dominant, ok := dominantField(fs[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+	return out
+}
+
+// dominantField follows fields.dominantField.
+func dominantField(fs []field) (field, bool) {
+	length := len(fs[0].index)
+	tagged := -1 // Index of first tagged field.
+	for i, f := range fs {
+		if len(f.index) > length {
+			fs = fs[:i]
+			break
+		}
+		if f.tag {
+			if tagged >= 0 {
+				return field{}, false
+			}
+			tagged = i
+		}
+	}
+	if tagged >= 0 {
+		return fs[tagged], true
+	}
+	if len(fs) > 1 {
+		return field{}, false
+	}
+	return fs[0], true
+}
+
+// byName sorts fields as fields.byName does.
+type byName []field
+
+func (x byName) Len() int { return len(x) }
+
+func (x byName) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+func (x byName) Less(i, j int) bool {
+	if x[i].name != x[j].name {
+		return x[i].name < x[j].name
+	}
+	if len(x[i].index) != len(x[j].index) {
+		return len(x[i].index) < len(x[j].index)
+	}
+	if x[i].tag != x[j].tag {
+		return x[i].tag
+	}
+	for k, xik := range x[i].index {
+		if k >= len(x[j].index) {
+			return false
+		}
+		if xik != x[j].index[k] {
+			return xik < x[j].index[k]
+		}
+	}
+	return len(x[i].index) < len(x[j].index)
+}
+
+// A generator accumulates generated code for a package.
+type generator struct {
+	pkg     *types.Package
+	types   map[*types.Named]*structType // types being generated
+	imports map[string]string            // import path to name
+}
+
+// importName returns the name by which generated code refers to the
+// package at path, importing it if necessary.
+func (g *generator) importName(path string) string {
+	if name, ok := g.imports[path]; ok {
+		return name
+	}
+	if g.imports == nil {
+		g.imports = map[string]string{}
+	}
+	base := importedName(path)
+	name := base
+	for n := 2; ; n++ {
+		inUse := false
+		for _, other := range g.imports {
+			inUse = inUse || other == name
+		}
+		if !inUse {
+			break
+		}
+		name = base + strconv.Itoa(n)
+	}
+	g.imports[path] = name
+	return name
+}
+
+// qualifier qualifies the names of types outside the generated package.
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	return g.importName(p.Path())
+}
+
+// A body accumulates the statements of a generated function.
+type body struct {
+	bytes.Buffer
+	usesErr bool
+}
+
+func (b *body) line(format string, args ...interface{}) {
+	fmt.Fprintf(b, format, args...)
+	b.WriteByte('\n')
+}
+
+// appendBody returns the statements of st's AppendCanonicalJSON method,
+// assuming that its receiver v is addressable if addr is true.
+func (g *generator) appendBody(st *structType, addr bool) string {
+	var b body
+	b.line("start := len(dst)")
+	for _, f := range st.fields {
+		var conds []string
+		x := "v"
+		for i, sf := range f.path {
+			x += "." + sf.Name()
+			if _, ok := types.Unalias(sf.Type()).(*types.Pointer); ok && i < len(f.path)-1 {
+				conds = append(conds, x+" != nil")
+			}
+		}
+		t := f.path[len(f.path)-1].Type()
+		if f.omitEmpty {
+			cond, always := nonEmpty(x, t)
+			if !always {
+				if cond == "" {
+					continue
+				}
+				conds = append(conds, cond)
+			}
+		}
+		if f.omitZero {
+			conds = append(conds, g.nonZero(x, t))
+		}
+		key, err := canonicaljson.Marshal(f.name)
+		if err != nil {
+			panic(err)
+		}
+		if len(conds) > 0 {
+			b.line("if %s {", strings.Join(conds, " && "))
+		}
+		b.line("dst = append(dst, %s...)", strconv.Quote(","+string(key)+":"))
+		g.appendValue(&b, x, t, f.quoted, addr, 0)
+		if len(conds) > 0 {
+			b.line("}")
+		}
+	}
+	b.line("if len(dst) == start {")
+	b.line("return append(dst, \"{}\"...), nil")
+	b.line("}")
+	b.line("dst[start] = '{'")
+	b.line("return append(dst, '}'), nil")
+
+	var decls string
+	if b.usesErr {
+		decls += "var err error\n"
+	}
+	return decls + b.String()
+}
+
+// nonEmpty returns an expression reporting whether x, of type t, is not
+// empty for the purposes of "omitempty", or "" if it is always empty;
+// always reports whether it is never empty.
+func nonEmpty(x string, t types.Type) (cond string, always bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Array:
+		return "", u.Len() != 0
+	case *types.Map, *types.Slice:
+		return "len(" + x + ") != 0", false
+	case *types.Pointer, *types.Interface:
+		return x + " != nil", false
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return x, false
+		case u.Info()&types.IsString != 0:
+			return "len(" + x + ") != 0", false
+		case u.Info()&(types.IsInteger|types.IsFloat) != 0:
+			return x + " != 0", false
+		}
+	}
+	return "", true
+}
+
+// nonZero returns an expression reporting whether x, an addressable
+// value of type t, is not zero for the purposes of "omitzero", following
+// fields.isZeroFunc.
+func (g *generator) nonZero(x string, t types.Type) string {
+	t = types.Unalias(t)
+	_, isPtr := t.(*types.Pointer)
+	switch {
+	case isInterface(t) && types.Implements(t, isZeroerIface):
+		// Avoid calling IsZero on a nil interface or a nil pointer.
+		rv := g.importName("reflect") + ".ValueOf(" + x + ")"
+		return fmt.Sprintf("%s != nil && !(%s.Kind() == %s.Ptr && %s.IsNil()) && !%s.IsZero()",
+			x, rv, g.importName("reflect"), rv, x)
+	case isPtr && types.Implements(t, isZeroerIface):
+		return x + " != nil && !" + operand(x) + ".IsZero()"
+	case types.Implements(t, isZeroerIface):
+		return "!" + operand(x) + ".IsZero()"
+	case types.Implements(types.NewPointer(t), isZeroerIface):
+		return "!(&" + x + ").IsZero()"
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if cond, _ := nonEmpty(x, t); cond != "" {
+			return cond
+		}
+	case *types.Pointer, *types.Interface, *types.Slice, *types.Map, *types.Chan, *types.Signature:
+		return x + " != nil"
+	case *types.Array, *types.Struct:
+		// Comparison with the zero value must neither panic nor
+		// distinguish values that reflect.Value.IsZero does not.
+		if types.Comparable(u) && !hasInterface(u, map[types.Type]bool{}) {
+			return fmt.Sprintf("%s != (%s{})", x, types.TypeString(t, g.qualifier))
+		}
+	}
+	return "!" + g.importName("reflect") + ".ValueOf(" + x + ").IsZero()"
+}
+
+// hasInterface reports whether a value of type t may contain an
+// interface value.
+func hasInterface(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		return true
+	case *types.Array:
+		return hasInterface(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if hasInterface(u.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	byteSliceType = types.NewSlice(types.Typ[types.Byte])
+	errorType     = types.Universe.Lookup("error").Type()
+
+	appendMarshalerIface    = newInterface("AppendCanonicalJSON", types.NewTuple(newVar(byteSliceType)))
+	canonicalMarshalerIface = newInterface("MarshalCanonicalJSON", nil)
+	marshalerIface          = newInterface("MarshalJSON", nil)
+	textMarshalerIface      = newInterface("MarshalText", nil)
+)
+
+// isZeroerIface is interface{ IsZero() bool }.
+var isZeroerIface = types.NewInterfaceType([]*types.Func{
+	types.NewFunc(token.NoPos, nil, "IsZero", types.NewSignatureType(nil, nil, nil, nil,
+		types.NewTuple(newVar(types.Typ[types.Bool])), false)),
+}, nil).Complete()
+
+func newVar(t types.Type) *types.Var {
+	return types.NewVar(token.NoPos, nil, "", t)
+}
+
+// newInterface returns an interface with a single method accepting params
+// and returning ([]byte, error).
+func newInterface(method string, params *types.Tuple) *types.Interface {
+	results := types.NewTuple(newVar(byteSliceType), newVar(errorType))
+	sig := types.NewSignatureType(nil, nil, nil, params, results, false)
+	return types.NewInterfaceType([]*types.Func{types.NewFunc(token.NoPos, nil, method, sig)}, nil).Complete()
+}
+
+// hasAppend reports whether t has an AppendCanonicalJSON method, either
+// already or as generated.
+func (g *generator) hasAppend(t types.Type) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		if named, ok := types.Unalias(p.Elem()).(*types.Named); ok && g.types[named] != nil {
+			return true
+		}
+	} else if named, ok := t.(*types.Named); ok && g.types[named] != nil {
+		return !g.types[named].addr
+	}
+	return types.Implements(t, appendMarshalerIface)
+}
+
+// appendValue writes statements appending the encoding of x, of type t,
+// to dst, following newTypeEncoder (with allowAddr corresponding to
+// whether x is addressable).
+func (g *generator) appendValue(b *body, x string, t types.Type, quoted, addr bool, depth int) {
+	t = types.Unalias(t)
+	_, isPtr := t.(*types.Pointer)
+	ptrTo := types.NewPointer(t)
+	cj := g.importName(canonicaljsonPath)
+
+	// Methods take precedence over the kind of t.
+	switch {
+	case isInterface(t):
+		g.appendMarshal(b, x)
+		return
+	case g.hasAppend(t):
+		if isPtr {
+			b.line("if %s == nil {", x)
+			b.line("dst = append(dst, \"null\"...)")
+			b.line("} else {")
+		}
+		b.usesErr = true
+		b.line("if dst, err = %s.AppendCanonicalJSON(dst); err != nil {", operand(x))
+		b.line("return nil, err")
+		b.line("}")
+		if isPtr {
+			b.line("}")
+		}
+		return
+	case addr && !isPtr && g.hasAppend(ptrTo):
+		b.usesErr = true
+		b.line("if dst, err = (&%s).AppendCanonicalJSON(dst); err != nil {", x)
+		b.line("return nil, err")
+		b.line("}")
+		return
+	case types.Implements(t, canonicalMarshalerIface):
+		g.appendMarshal(b, x)
+		return
+	case addr && !isPtr && types.Implements(ptrTo, canonicalMarshalerIface):
+		g.appendMarshal(b, "&"+x)
+		return
+	case types.Implements(t, marshalerIface):
+		g.appendMarshal(b, x)
+		return
+	case addr && !isPtr && types.Implements(ptrTo, marshalerIface):
+		g.appendMarshal(b, "&"+x)
+		return
+	case types.Implements(t, textMarshalerIface):
+		g.appendMarshal(b, x)
+		return
+	case addr && !isPtr && types.Implements(ptrTo, textMarshalerIface):
+		g.appendMarshal(b, "&"+x)
+		return
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsString != 0 && isNumber(t):
+			b.usesErr = true
+			b.line("if dst, err = %s.AppendNumber(dst, %s.Number(%s)); err != nil {", cj, cj, x)
+			b.line("return nil, err")
+			b.line("}")
+		case info&types.IsString != 0:
+			b.usesErr = true
+			b.line("if dst, err = %s.AppendString(dst, string(%s), %t); err != nil {", cj, x, quoted)
+			b.line("return nil, err")
+			b.line("}")
+		case info&types.IsFloat != 0 && info&types.IsComplex == 0:
+			b.usesErr = true
+			bits := 64
+			if u.Kind() == types.Float32 {
+				bits = 32
+			}
+			b.line("if dst, err = %s.AppendFloat(dst, float64(%s), %d, %t); err != nil {", cj, x, bits, quoted)
+			b.line("return nil, err")
+			b.line("}")
+		case info&(types.IsBoolean|types.IsInteger) != 0:
+			sc := g.importName("strconv")
+			if quoted {
+				b.line("dst = append(dst, '\"')")
+			}
+			switch {
+			case info&types.IsBoolean != 0:
+				b.line("dst = %s.AppendBool(dst, bool(%s))", sc, x)
+			case info&types.IsUnsigned != 0:
+				b.line("dst = %s.AppendUint(dst, uint64(%s), 10)", sc, x)
+			default:
+				b.line("dst = %s.AppendInt(dst, int64(%s), 10)", sc, x)
+			}
+			if quoted {
+				b.line("dst = append(dst, '\"')")
+			}
+		default:
+			g.appendMarshal(b, x)
+		}
+
+	case *types.Pointer:
+		b.line("if %s == nil {", x)
+		b.line("dst = append(dst, \"null\"...)")
+		b.line("} else {")
+		g.appendValue(b, "*"+x, u.Elem(), quoted, true, depth)
+		b.line("}")
+
+	case *types.Slice:
+		if elem, ok := u.Elem().Underlying().(*types.Basic); ok && elem.Kind() == types.Uint8 {
+			// Byte slices are encoded as base64.
+			g.appendMarshal(b, x)
+			return
+		}
+		b.line("if %s == nil {", x)
+		b.line("dst = append(dst, \"null\"...)")
+		b.line("} else {")
+		g.appendElements(b, x, u.Elem(), true, depth)
+		b.line("}")
+
+	case *types.Array:
+		g.appendElements(b, x, u.Elem(), addr, depth)
+
+	case *types.Struct:
+		if addr && g.addrMatters(t, map[types.Type]bool{}) {
+			// Preserve the addressability of fields.
+			g.appendMarshal(b, "&"+x)
+		} else {
+			g.appendMarshal(b, x)
+		}
+
+	default:
+		g.appendMarshal(b, x)
+	}
+}
+
+// addrMatters reports whether the encoding of a value of type t depends on
+// whether it is addressable, because t or a type it contains has methods
+// that affect encoding only on its pointer type.
+func (g *generator) addrMatters(t types.Type, seen map[types.Type]bool) bool {
+	t = types.Unalias(t)
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	if isInterface(t) || g.hasAppend(t) || implementsMarshaler(t) {
+		return false
+	}
+	ptrTo := types.NewPointer(t)
+	if _, isPtr := t.(*types.Pointer); !isPtr && (g.hasAppend(ptrTo) || implementsMarshaler(ptrTo)) {
+		return true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Array:
+		return g.addrMatters(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if g.addrMatters(u.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// implementsMarshaler reports whether t has a method other than
+// AppendCanonicalJSON that determines its encoding.
+func implementsMarshaler(t types.Type) bool {
+	return types.Implements(t, canonicalMarshalerIface) ||
+		types.Implements(t, marshalerIface) ||
+		types.Implements(t, textMarshalerIface)
+}
+
+// operand returns x in a form that can be followed by a selector or index.
+func operand(x string) string {
+	if strings.HasPrefix(x, "*") {
+		return "(" + x + ")"
+	}
+	return x
+}
+
+// appendElements writes statements appending the JSON array encoding of
+// the elements of x, of type elem, to dst.
+func (g *generator) appendElements(b *body, x string, elem types.Type, addr bool, depth int) {
+	i := "i" + strconv.Itoa(depth)
+	b.line("dst = append(dst, '[')")
+	b.line("for %s := range %s {", i, x)
+	b.line("if %s > 0 {", i)
+	b.line("dst = append(dst, ',')")
+	b.line("}")
+	g.appendValue(b, operand(x)+"["+i+"]", elem, false, addr, depth+1)
+	b.line("}")
+	b.line("dst = append(dst, ']')")
+}
+
+// appendMarshal writes statements appending the encoding of x by
+// canonicaljson.AppendMarshal to dst.
+func (g *generator) appendMarshal(b *body, x string) {
+	b.usesErr = true
+	b.line("if dst, err = %s.AppendMarshal(dst, %s); err != nil {", g.importName(canonicaljsonPath), x)
+	b.line("return nil, err")
+	b.line("}")
+}
+
+func isInterface(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Interface)
+	return ok
+}
+
+// isNumber reports whether t is canonicaljson.Number or json.Number,
+// which are encoded as their normalized literal values.
+func isNumber(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Name() != "Number" {
+		return false
+	}
+	path := named.Obj().Pkg().Path()
+	return path == canonicaljsonPath || path == "encoding/json"
+}
+
+// writeMethods writes the methods for st to w.
+func (g *generator) writeMethods(w *bytes.Buffer, st *structType) {
+	name := st.named.Obj().Name()
+	recv := name
+	if st.addr {
+		recv = "*" + name
+	}
+	namesVar := "_" + name + "_canonicalJSONNames"
+	cj := g.importName(canonicaljsonPath)
+
+	fmt.Fprintf(w, "\n// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.\n")
+	fmt.Fprintf(w, "func (v %s) AppendCanonicalJSON(dst []byte) ([]byte, error) {\n", recv)
+	w.WriteString(g.appendBody(st, st.addr))
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "\n// UnmarshalJSON decodes the JSON object in data into v.\n")
+	fmt.Fprintf(w, "func (v *%s) UnmarshalJSON(data []byte) error {\n", name)
+	w.WriteString("names, field := v.CanonicalJSONFields()\n")
+	fmt.Fprintf(w, "return %s.UnmarshalFields(data, v, names, field)\n}\n", cj)
+
+	fmt.Fprintf(w, "\n// CanonicalJSONFields returns the JSON member names of v and a function\n")
+	fmt.Fprintf(w, "// locating their fields, as for %s.UnmarshalFields.\n", cj)
+	fmt.Fprintf(w, "func (v *%s) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {\n", name)
+	fmt.Fprintf(w, "return %s, func(i int) (interface{}, bool) {\n", namesVar)
+	if len(st.fields) > 0 {
+		w.WriteString("switch i {\n")
+		for i, f := range st.fields {
+			fmt.Fprintf(w, "case %d:\n", i)
+			x := "v"
+			for j, sf := range f.path {
+				x += "." + sf.Name()
+				if p, ok := types.Unalias(sf.Type()).(*types.Pointer); ok && j < len(f.path)-1 {
+					fmt.Fprintf(w, "if %s == nil {\n%s = new(%s)\n}\n", x, x, types.TypeString(p.Elem(), g.qualifier))
+				}
+			}
+			fmt.Fprintf(w, "return &%s, %t\n", x, f.quoted)
+		}
+		w.WriteString("}\n")
+	}
+	w.WriteString("return nil, false\n")
+	w.WriteString("}\n}\n")
+
+	fmt.Fprintf(w, "\nvar %s = []string{", namesVar)
+	for i, f := range st.fields {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(strconv.Quote(f.name))
+	}
+	w.WriteString("}\n")
+}
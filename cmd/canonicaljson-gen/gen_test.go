@@ -0,0 +1,39 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestGolden checks that the generated code in internal/gentest, which is
+// tested against the reflective encoder and decoder there, is up to date.
+func TestGolden(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	const name = "types_canonicaljson.go"
+	want, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(dir, name, []string{"Scalars", "Composite", "Embedding", "Addressed", "Zeros", "Empty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated code differs from %s; run go generate in %s", name, dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	for _, names := range [][]string{{"Missing"}, {"Celsius"}, {"Scalars", "Flag"}, {"Open"}, {"Roles"}} {
+		if _, err := generate(dir, "", names); err == nil {
+			t.Errorf("generate(%v): expected error", names)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Canonicaljson-gen generates methods that encode and decode struct types
+// as canonical JSON without the per-value reflection of
+// canonicaljson.Marshal and canonicaljson.Unmarshal.
+//
+// Given the name of a struct type T, canonicaljson-gen writes a Go source
+// file defining
+//
+//	func (v T) AppendCanonicalJSON(dst []byte) ([]byte, error)
+//	func (v *T) UnmarshalJSON(data []byte) error
+//	func (v *T) CanonicalJSONFields() ([]string, func(int) (interface{}, bool))
+//
+// with object members resolved and sorted at generation time according to
+// the same rules (names, "omitempty", "omitzero", "string", and
+// embedding) as the reflective encoder, whose output the generated code
+// reproduces byte for byte. canonicaljson.Marshal uses AppendCanonicalJSON
+// when present. canonicaljson.Unmarshal and canonicaljson.Decoder decode
+// objects into the fields described by CanonicalJSONFields (see
+// canonicaljson.FieldsUnmarshaler), honoring the Decoder's options, while
+// other decoders such as encoding/json.Unmarshal use UnmarshalJSON.
+// AppendCanonicalJSON has a pointer receiver instead when the encoding of
+// some field depends on its addressability (i.e., the field's type has
+// marshaling methods such as MarshalJSON only on its pointer type).
+//
+// Fields of bool, numeric, string, pointer, slice, and array types, and of
+// types in the same invocation, are encoded inline; others fall back to
+// canonicaljson.AppendMarshal. A type that embeds a generated type should be
+// generated as well, or it will be encoded by the promoted method of the
+// embedded field. Struct types with a field having the "inline" or
+// "set" option are not supported.
+//
+// Typical use is a directive in the package defining the types:
+//
+//	//go:generate canonicaljson-gen -type=Record,Header
+//
+// Usage:
+//
+//	canonicaljson-gen -type T[,T...] [-output file] [directory]
+//
+// The default output file is t_canonicaljson.go for the first type T, in
+// the package directory (by default the current directory).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default <dir>/<type>_canonicaljson.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: canonicaljson-gen -type T[,T...] [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("canonicaljson-gen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	names := strings.Split(*typeNames, ",")
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(names[0])+"_canonicaljson.go")
+	}
+
+	src, err := generate(dir, filepath.Base(outputName), names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
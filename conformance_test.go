@@ -0,0 +1,141 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// specTestDirs are searched for test vectors in the layout of
+// canonicaljson-spec: this package's own hand-written cases under testdata,
+// and the spec's vectors in the git submodule, if checked out. The spec's
+// vectors are not vendored, so they are checked only with the submodule.
+var specTestDirs = []string{
+	filepath.Join("testdata", "conformance"),
+	specVectorDir,
+}
+
+// specVectorDir holds the spec's own test vectors.
+var specVectorDir = filepath.Join("canonicaljson-spec", "test")
+
+// A specVector is a canonicaljson-spec test case: a directory holding
+// input.json and, unless the input is invalid, expected.json.
+type specVector struct {
+	name     string
+	input    []byte
+	expected []byte // nil if input must be rejected
+}
+
+// loadSpecVectors returns the test vectors found in dir.
+func loadSpecVectors(dir string) ([]specVector, error) {
+	inputs, err := filepath.Glob(filepath.Join(dir, "*", "input.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(inputs)
+	var vectors []specVector
+	for _, input := range inputs {
+		vdir := filepath.Dir(input)
+		v := specVector{name: filepath.Base(vdir)}
+		if v.input, err = ioutil.ReadFile(input); err != nil {
+			return nil, err
+		}
+		v.expected, err = ioutil.ReadFile(filepath.Join(vdir, "expected.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// canonicalizeUnmarshal canonicalizes data with Unmarshal and Marshal.
+func canonicalizeUnmarshal(data []byte) ([]byte, error) {
+	v, err := unmarshalGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(v)
+}
+
+// canonicalizeStream canonicalizes data with a Decoder and an Encoder,
+// requiring the input to contain exactly one value.
+func canonicalizeStream(data []byte) ([]byte, error) {
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &SyntaxError{"invalid character after top-level value", int64(len(data))}
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func TestSpecConformance(t *testing.T) {
+	found := false
+	for _, dir := range specTestDirs {
+		vectors, err := loadSpecVectors(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vectors) == 0 {
+			if dir == specVectorDir {
+				t.Logf("no vectors in %s; not checking conformance to the spec's own vectors (run git submodule update --init)", dir)
+			}
+			continue
+		}
+		found = true
+		t.Run(dir, func(t *testing.T) {
+			for _, v := range vectors {
+				v := v
+				t.Run(v.name, func(t *testing.T) {
+					testSpecVector(t, v)
+				})
+			}
+		})
+	}
+	if !found {
+		t.Skip("no conformance test vectors found")
+	}
+}
+
+func testSpecVector(t *testing.T, v specVector) {
+	for _, path := range []struct {
+		name         string
+		canonicalize func([]byte) ([]byte, error)
+	}{
+		{"Unmarshal", canonicalizeUnmarshal},
+		{"Decoder", canonicalizeStream},
+	} {
+		got, err := path.canonicalize(v.input)
+		switch {
+		case v.expected == nil && err == nil:
+			t.Errorf("%s: accepted invalid input %q as %q", path.name, v.input, got)
+		case v.expected != nil && err != nil:
+			t.Errorf("%s: %q: %v", path.name, v.input, err)
+		case v.expected != nil && !bytes.Equal(got, v.expected):
+			t.Errorf("%s: %q:\n got: %q\nwant: %q", path.name, v.input, got, v.expected)
+		}
+	}
+
+	// Canonical output is itself canonical.
+	if v.expected != nil {
+		if got, err := canonicalizeUnmarshal(v.expected); err != nil || !bytes.Equal(got, v.expected) {
+			t.Errorf("not idempotent: %q => %q, %v", v.expected, got, err)
+		}
+	}
+}
@@ -9,7 +9,6 @@
 package canonicaljson
 
 import (
-	"bytes"
 	"encoding"
 	"encoding/base64"
 	"errors"
@@ -17,9 +16,12 @@ import (
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
+
+	"github.com/gibson042/canonicaljson-go/internal/fields"
 )
 
 // Unmarshal parses the JSON-encoded UTF-8 data and stores the result
@@ -35,10 +37,24 @@ import (
 // the value pointed at by the pointer. If the pointer is nil, Unmarshal
 // allocates a new value for it to point to.
 //
+// To unmarshal JSON into a value implementing the CanonicalUnmarshaler
+// interface, Unmarshal calls its UnmarshalCanonicalJSON method with the
+// canonical form of the JSON. Otherwise, to unmarshal JSON into a value
+// implementing the Unmarshaler interface, Unmarshal calls its
+// UnmarshalJSON method with the JSON as is, unless the value implements
+// FieldsUnmarshaler and the JSON is an object, which Unmarshal decodes into
+// the fields it describes.
+//
 // To unmarshal JSON into a struct, Unmarshal matches incoming object
 // keys to the keys used by Marshal (either the struct field name or its tag),
-// preferring an exact match but also accepting a case-insensitive match.
-// Unmarshal will only set exported fields of the struct.
+// preferring an exact match but also accepting a case-insensitive match
+// (see Decoder.ExactFieldNames to accept only exact matches).
+// Unmarshal will only set exported fields of the struct. Members matching no
+// field are ignored, unless the struct has a map field with the "inline"
+// option (see Marshal), in which case they are stored in that map. Such a
+// struct accepts only exact matches, so that re-marshaling it reproduces
+// every member: the map also receives keys matching a field only
+// case-insensitively.
 //
 // To unmarshal JSON into an interface value,
 // Unmarshal stores one of these in the interface value:
@@ -105,6 +121,141 @@ func Unmarshal(data []byte, v interface{}) error {
 	return d.unmarshal(v)
 }
 
+// unmarshalGeneric is like Unmarshal into an interface{}, but represents
+// numbers as Number so that their exact text is preserved.
+func unmarshalGeneric(data []byte) (interface{}, error) {
+	var d decodeState
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	d.init(data)
+	d.useNumber = true
+	err = d.unmarshal(&v)
+	return v, err
+}
+
+// UnmarshalFields decodes the JSON object in data into the struct pointed
+// to by v without reflecting on its fields, for use by methods such as
+// those generated by canonicaljson-gen.
+// names lists the JSON member names of the struct in the order used by
+// Marshal. For each object member matching names[i] (exactly or else
+// case-insensitively), field(i) returns a pointer to the destination
+// value and whether the field has the "string" option. Members matching
+// no name are ignored.
+//
+// As with Unmarshal, a JSON null has no effect, and any other non-object
+// value results in an UnmarshalTypeError.
+func UnmarshalFields(data []byte, v interface{}, names []string, field func(i int) (ptr interface{}, quoted bool)) error {
+	var d decodeState
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return err
+	}
+
+	d.init(data)
+	return d.unmarshalFields(v, names, field)
+}
+
+func (d *decodeState) unmarshalFields(v interface{}, names []string, field func(int) (interface{}, bool)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			err = r.(error)
+		}
+	}()
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+
+	d.scan.reset()
+	switch op := d.scanWhile(scanSkipSpace); op {
+	default:
+		d.error(errPhase)
+
+	case scanBeginArray:
+		d.saveError(&UnmarshalTypeError{"array", rv.Type().Elem(), int64(d.off)})
+		d.off--
+		d.next()
+
+	case scanBeginObject:
+		d.fieldsObject(rv.Type().Elem(), names, field)
+
+	case scanBeginLiteral:
+		// Unlike d.literal, do not look for unmarshalers, which would
+		// find v itself.
+		start := d.off - 1
+		op := d.scanWhile(scanContinue)
+		d.off--
+		d.scan.undo(op)
+		switch d.data[start] {
+		case 'n': // null
+		case 't', 'f':
+			d.saveError(&UnmarshalTypeError{"bool", rv.Type().Elem(), int64(d.off)})
+		case '"':
+			d.saveError(&UnmarshalTypeError{"string", rv.Type().Elem(), int64(d.off)})
+		default:
+			d.error(&UnmarshalTypeError{"number", rv.Type().Elem(), int64(d.off)})
+		}
+	}
+	return d.savedError
+}
+
+// fieldsObject consumes the members of an object into the fields of a
+// value of struct type t described by names and field (see
+// UnmarshalFields), the opening brace having been read already.
+func (d *decodeState) fieldsObject(t reflect.Type, names []string, field func(int) (interface{}, bool)) {
+	d.objectMembers(func(key []byte) (reflect.Value, bool) {
+		i := d.matchName(t, names, key)
+		if i < 0 {
+			return reflect.Value{}, false
+		}
+		ptr, quoted := field(i)
+		return reflect.ValueOf(ptr).Elem(), quoted
+	}, nil)
+}
+
+// matchName returns the index of the first of names (of the fields of
+// struct type t) equal to key, or failing that of the first
+// case-insensitive match, or -1 if none match. When matching exact names
+// only, a case-insensitive match is skipped (and reported if strict), as
+// by lookupField.
+func (d *decodeState) matchName(t reflect.Type, names []string, key []byte) int {
+	match := -1
+	for i, name := range names {
+		if name == string(key) {
+			return i
+		}
+		if match < 0 && strings.EqualFold(name, string(key)) {
+			match = i
+		}
+	}
+	if match < 0 || !d.exactNames {
+		return match
+	}
+	if d.strictNames {
+		d.saveError(&FieldCaseError{string(key), names[match], t, int64(d.off)})
+	}
+	return -1
+}
+
+// FieldsUnmarshaler is the interface implemented by types generated by
+// canonicaljson-gen, which describe their fields as for UnmarshalFields so
+// that a JSON object can be decoded into them without reflection. Unlike
+// UnmarshalJSON, decoding them this way honors the options of a Decoder
+// (such as ExactNumbers and ExactFieldNames) and does not parse the
+// object again.
+type FieldsUnmarshaler interface {
+	Unmarshaler
+	CanonicalJSONFields() (names []string, field func(i int) (ptr interface{}, quoted bool))
+}
+
 // Unmarshaler is the interface implemented by objects
 // that can unmarshal a JSON description of themselves.
 // The input can be assumed to be a valid encoding of
@@ -114,6 +265,31 @@ type Unmarshaler interface {
 	UnmarshalJSON([]byte) error
 }
 
+// CanonicalUnmarshaler is the interface implemented by objects that can
+// unmarshal a JSON description of themselves from its canonical form,
+// e.g. to compute a stable digest of their content. Instead of the input
+// text of the value, UnmarshalCanonicalJSON receives its canonical
+// encoding as produced by Marshal (in which, for instance, object members
+// with duplicate names have been collapsed and the remaining members
+// sorted). It takes precedence over UnmarshalJSON, and must copy the
+// data if it wishes to retain the data after returning.
+type CanonicalUnmarshaler interface {
+	UnmarshalCanonicalJSON([]byte) error
+}
+
+// canonicalUnmarshaler adapts a CanonicalUnmarshaler to Unmarshaler.
+type canonicalUnmarshaler struct {
+	u CanonicalUnmarshaler
+}
+
+func (c canonicalUnmarshaler) UnmarshalJSON(data []byte) error {
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return err
+	}
+	return c.u.UnmarshalCanonicalJSON(canonical)
+}
+
 // An UnmarshalTypeError describes a JSON value that was
 // not appropriate for a value of a specific Go type.
 type UnmarshalTypeError struct {
@@ -126,6 +302,33 @@ func (e *UnmarshalTypeError) Error() string {
 	return "canonicaljson: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
 }
 
+// A FieldCaseError describes an object key that matches the name of a
+// struct field only case-insensitively, when a Decoder is matching exact
+// names (see Decoder.ExactFieldNames).
+type FieldCaseError struct {
+	Key    string       // the object key
+	Field  string       // the name of the field it differs from in case
+	Type   reflect.Type // the struct type
+	Offset int64        // error occurred after reading Offset bytes
+}
+
+func (e *FieldCaseError) Error() string {
+	return "canonicaljson: object key " + strconv.Quote(e.Key) + " matches field " + strconv.Quote(e.Field) + " of Go struct type " + e.Type.String() + " only case-insensitively"
+}
+
+// A PrecisionError describes a JSON number that cannot be decoded exactly
+// into a floating point value, when a Decoder requires exact numbers (see
+// Decoder.ExactNumbers).
+type PrecisionError struct {
+	Value  string       // the JSON number
+	Type   reflect.Type // type of Go value it was decoded into
+	Offset int64        // error occurred after reading Offset bytes
+}
+
+func (e *PrecisionError) Error() string {
+	return "canonicaljson: number " + e.Value + " cannot be represented exactly in Go value of type " + e.Type.String()
+}
+
 // An UnmarshalFieldError describes a JSON object key that
 // led to an unexported (and therefore unwritable) struct field.
 // (No longer used; kept for compatibility.)
@@ -263,6 +466,11 @@ type decodeState struct {
 	nextscan   scanner // for calls to nextValue
 	savedError error
 	useNumber  bool
+
+	exactNames  bool // match struct fields by exact name only
+	strictNames bool // report case-insensitive matches when exactNames
+
+	exactNumbers bool // report numbers that floats cannot represent exactly
 }
 
 // errPhase is used for errors that should not happen unless
@@ -318,6 +526,9 @@ func (d *decodeState) next() []byte {
 func (d *decodeState) scanWhile(op int) int {
 	var newOp int
 	for {
+		if op == scanContinue && d.scan.run != runNone {
+			d.off += d.scan.continueRun(d.data[d.off:])
+		}
 		if d.off >= len(d.data) {
 			newOp = d.scan.eof()
 			d.off = len(d.data) + 1 // mark processed EOF with len+1
@@ -440,6 +651,9 @@ func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (Unmarshaler,
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 		if v.Type().NumMethod() > 0 {
+			if u, ok := v.Interface().(CanonicalUnmarshaler); ok {
+				return canonicalUnmarshaler{u}, nil, reflect.Value{}
+			}
 			if u, ok := v.Interface().(Unmarshaler); ok {
 				return u, nil, reflect.Value{}
 			}
@@ -565,6 +779,11 @@ var nullLiteral = []byte("null")
 func (d *decodeState) object(v reflect.Value) {
 	// Check for unmarshaler.
 	u, ut, pv := d.indirect(v, false)
+	if fu, ok := u.(FieldsUnmarshaler); ok {
+		names, field := fu.CanonicalJSONFields()
+		d.fieldsObject(reflect.TypeOf(fu).Elem(), names, field)
+		return
+	}
 	if u != nil {
 		d.off--
 		err := u.UnmarshalJSON(d.next())
@@ -602,7 +821,8 @@ func (d *decodeState) object(v reflect.Value) {
 			v.Set(reflect.MakeMap(t))
 		}
 	case reflect.Struct:
-
+		d.structObject(v)
+		return
 	default:
 		d.saveError(&UnmarshalTypeError{"object", v.Type(), int64(d.off)})
 		d.off--
@@ -611,7 +831,100 @@ func (d *decodeState) object(v reflect.Value) {
 	}
 
 	var mapElem reflect.Value
+	elemType := v.Type().Elem()
+	d.objectMembers(func([]byte) (reflect.Value, bool) {
+		if !mapElem.IsValid() {
+			mapElem = reflect.New(elemType).Elem()
+		} else {
+			mapElem.Set(reflect.Zero(elemType))
+		}
+		return mapElem, false
+	}, func(key []byte, subv reflect.Value) {
+		// Write value back to map.
+		kv := reflect.ValueOf(key).Convert(v.Type().Key())
+		v.SetMapIndex(kv, subv)
+	})
+}
 
+// structObject consumes the members of an object into struct v, the
+// opening brace having been read already. If v has an ",inline" field, it
+// collects every member whose key is not exactly the name of another field.
+func (d *decodeState) structObject(v reflect.Value) {
+	fs := fields.CachedTypeFields(v.Type())
+	inline := fields.Inline(fs)
+	if inline == nil {
+		d.objectMembers(func(key []byte) (reflect.Value, bool) {
+			return d.structField(v, d.lookupField(v.Type(), fs, key))
+		}, nil)
+		return
+	}
+
+	var extra, mapElem reflect.Value
+	var unknown bool // whether the current member is unknown
+	d.objectMembers(func(key []byte) (reflect.Value, bool) {
+		f := fields.LookupExact(fs, key)
+		if unknown = f == nil; !unknown {
+			return d.structField(v, f)
+		}
+		if !extra.IsValid() {
+			extra, _ = d.structField(v, inline)
+			if extra.IsNil() {
+				extra.Set(reflect.MakeMap(extra.Type()))
+			}
+			mapElem = reflect.New(extra.Type().Elem()).Elem()
+		} else {
+			mapElem.Set(reflect.Zero(mapElem.Type()))
+		}
+		return mapElem, false
+	}, func(key []byte, subv reflect.Value) {
+		if unknown {
+			kv := reflect.ValueOf(key).Convert(extra.Type().Key())
+			extra.SetMapIndex(kv, subv)
+		}
+	})
+}
+
+// lookupField returns the field of fs (the fields of struct type t) that
+// an object member named key decodes into, or nil if there is none. When
+// matching exact names only, a case-insensitive match is skipped (and
+// reported if strict).
+func (d *decodeState) lookupField(t reflect.Type, fs []fields.Field, key []byte) *fields.Field {
+	f := fields.Lookup(fs, key)
+	if f == nil || !d.exactNames || string(f.NameBytes) == string(key) {
+		return f
+	}
+	if d.strictNames {
+		d.saveError(&FieldCaseError{string(key), f.Name, t, int64(d.off)})
+	}
+	return nil
+}
+
+// structField returns field f of struct v, or the zero Value if f is nil,
+// and whether the field has the ",string" option. Pointers to embedded
+// structs are allocated as needed.
+func (d *decodeState) structField(v reflect.Value, f *fields.Field) (reflect.Value, bool) {
+	if f == nil {
+		return reflect.Value{}, false
+	}
+	subv := v
+	for _, i := range f.Index {
+		if subv.Kind() == reflect.Ptr {
+			if subv.IsNil() {
+				subv.Set(reflect.New(subv.Type().Elem()))
+			}
+			subv = subv.Elem()
+		}
+		subv = subv.Field(i)
+	}
+	return subv, f.Quoted
+}
+
+// objectMembers consumes the members of an object from d.data[d.off:],
+// the opening brace having been read already. For each member, target
+// returns the value to decode into (or the zero Value to skip it) and
+// whether the value is wrapped in a string to be decoded first. If store
+// is not nil, it is called with each key and value after decoding.
+func (d *decodeState) objectMembers(target func(key []byte) (reflect.Value, bool), store func(key []byte, subv reflect.Value)) {
 	for {
 		// Read opening " of string key or closing }.
 		op := d.scanWhile(scanSkipSpace)
@@ -632,45 +945,8 @@ func (d *decodeState) object(v reflect.Value) {
 			d.error(errPhase)
 		}
 
-		// Figure out field corresponding to key.
-		var subv reflect.Value
-		destring := false // whether the value is wrapped in a string to be decoded first
-
-		if v.Kind() == reflect.Map {
-			elemType := v.Type().Elem()
-			if !mapElem.IsValid() {
-				mapElem = reflect.New(elemType).Elem()
-			} else {
-				mapElem.Set(reflect.Zero(elemType))
-			}
-			subv = mapElem
-		} else {
-			var f *field
-			fields := cachedTypeFields(v.Type())
-			for i := range fields {
-				ff := &fields[i]
-				if bytes.Equal(ff.nameBytes, key) {
-					f = ff
-					break
-				}
-				if f == nil && ff.equalFold(ff.nameBytes, key) {
-					f = ff
-				}
-			}
-			if f != nil {
-				subv = v
-				destring = f.quoted
-				for _, i := range f.index {
-					if subv.Kind() == reflect.Ptr {
-						if subv.IsNil() {
-							subv.Set(reflect.New(subv.Type().Elem()))
-						}
-						subv = subv.Elem()
-					}
-					subv = subv.Field(i)
-				}
-			}
-		}
+		// Figure out the value corresponding to key.
+		subv, destring := target(key)
 
 		// Read : before value.
 		if op == scanSkipSpace {
@@ -694,11 +970,8 @@ func (d *decodeState) object(v reflect.Value) {
 			d.value(subv)
 		}
 
-		// Write value back to map;
-		// if using struct, subv points into struct already.
-		if v.Kind() == reflect.Map {
-			kv := reflect.ValueOf(key).Convert(v.Type().Key())
-			v.SetMapIndex(kv, subv)
+		if store != nil {
+			store(key, subv)
 		}
 
 		// Next token must be , or }.
@@ -737,9 +1010,22 @@ func (d *decodeState) convertNumber(s string) (interface{}, error) {
 	if err != nil {
 		return nil, &UnmarshalTypeError{"number " + s, reflect.TypeOf(0.0), int64(d.off)}
 	}
+	d.checkPrecision(s, f, reflect.TypeOf(0.0))
 	return f, nil
 }
 
+// checkPrecision saves a PrecisionError if d requires exact numbers and
+// the canonical form of JSON number s differs from that of f, its value as
+// floating point type t.
+func (d *decodeState) checkPrecision(s string, f float64, t reflect.Type) {
+	if !d.exactNumbers {
+		return
+	}
+	if canonicalNumber([]byte(s)) != canonicalNumber(strconv.AppendFloat(nil, f, 'E', -1, t.Bits())) {
+		d.saveError(&PrecisionError{s, t, int64(d.off)})
+	}
+}
+
 var numberType = reflect.TypeOf(Number(""))
 
 // literalStore decodes a literal stored in item into v.
@@ -906,6 +1192,7 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 				d.saveError(&UnmarshalTypeError{"number " + s, v.Type(), int64(d.off)})
 				break
 			}
+			d.checkPrecision(s, n, v.Type())
 			v.SetFloat(n)
 		}
 	}
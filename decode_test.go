@@ -8,6 +8,7 @@ package canonicaljson
 import (
 	"bytes"
 	"encoding"
+	"errors"
 	"fmt"
 	"image"
 	"net"
@@ -1446,3 +1447,105 @@ func TestInvalidStringOption(t *testing.T) {
 		t.Fatalf("Unmarshal: %v", err)
 	}
 }
+
+// canonicalRecorder records the canonical form of its JSON description.
+type canonicalRecorder struct {
+	canonical string
+}
+
+func (r *canonicalRecorder) UnmarshalCanonicalJSON(data []byte) error {
+	if string(data) == `"fail"` {
+		return errors.New("canonicalRecorder failure")
+	}
+	r.canonical = string(data)
+	return nil
+}
+
+// UnmarshalJSON is ignored in favor of UnmarshalCanonicalJSON.
+func (r *canonicalRecorder) UnmarshalJSON(data []byte) error {
+	r.canonical = "raw " + string(data)
+	return nil
+}
+
+func TestCanonicalUnmarshaler(t *testing.T) {
+	in := `{"obj": {"z": 1.0, "b": "A", "b": 0.10},
+		"arr": [ 1E3, {} ], "str": "é\t", "num": -0.0, "ptr": null, "ptr2": true}`
+	var v struct {
+		Obj, Arr, Str, Num canonicalRecorder
+		Ptr, Ptr2          *canonicalRecorder
+	}
+	v.Ptr = new(canonicalRecorder)
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		r    *canonicalRecorder
+		want string
+	}{
+		{&v.Obj, `{"b":1.0E-1,"z":1}`},
+		{&v.Arr, `[1000,{}]`},
+		{&v.Str, `"é\t"`},
+		{&v.Num, `0`},
+		{v.Ptr2, `true`},
+	} {
+		if tt.r.canonical != tt.want {
+			t.Errorf("UnmarshalCanonicalJSON received %#q, want %#q", tt.r.canonical, tt.want)
+		}
+	}
+	if v.Ptr != nil {
+		t.Errorf("null unmarshaled into %#v, want nil", v.Ptr)
+	}
+
+	var rs []canonicalRecorder
+	dec := NewDecoder(strings.NewReader(`[{"a" : [ ]}, "fail"]`))
+	err := dec.Decode(&rs)
+	if err == nil || err.Error() != "canonicalRecorder failure" {
+		t.Errorf("Decode error = %v, want canonicalRecorder failure", err)
+	}
+	if len(rs) != 2 || rs[0].canonical != `{"a":[]}` {
+		t.Errorf("Decode = %#v", rs)
+	}
+}
+
+type inlineOuter struct {
+	*InlineInner
+	A int `json:"a"`
+}
+
+type InlineInner struct {
+	Z     string                `json:"z"`
+	Extra map[string]RawMessage `json:",inline"`
+}
+
+func TestUnmarshalInline(t *testing.T) {
+	var v Inline
+	in := `{"a":1,"B":2,"b":3,"d":"x","zz":{"k":["v"]}}`
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	want := Inline{B: 3, D: "x", Extra: map[string]interface{}{
+		"a":  1.0,
+		"B":  2.0,
+		"zz": map[string]interface{}{"k": []interface{}{"v"}},
+	}}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Unmarshal(%#q):\n got: %#v\nwant: %#v", in, v, want)
+	}
+
+	// An inline map reached through an embedded pointer round-trips.
+	in = `{"a":1,"b":[true],"y":null,"z":"z"}`
+	var o inlineOuter
+	if err := Unmarshal([]byte(in), &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.InlineInner == nil || len(o.Extra) != 2 || string(o.Extra["b"]) != "[true]" || string(o.Extra["y"]) != "null" {
+		t.Errorf("Unmarshal(%#q): got %#v", in, o.InlineInner)
+	}
+	out, err := Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("Marshal(Unmarshal(%#q)) = %s", in, out)
+	}
+}
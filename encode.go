@@ -26,6 +26,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
 	"regexp"
@@ -34,14 +35,20 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"unicode"
+	"sync/atomic"
 	"unicode/utf8"
+
+	"github.com/gibson042/canonicaljson-go/internal/fields"
 )
 
 // Marshal returns the canonical UTF-8 JSON encoding of v.
 //
 // Marshal traverses the value v recursively.
-// If an encountered value implements the json.Marshaler interface
+// If an encountered value implements the AppendMarshaler or
+// CanonicalMarshaler interface and is not a nil pointer, Marshal calls
+// its AppendCanonicalJSON or else MarshalCanonicalJSON method and uses
+// the result as is (but see Encoder.SetVerifyMarshalers). Otherwise,
+// if an encountered value implements the json.Marshaler interface
 // and is not a nil pointer, Marshal calls its MarshalJSON method
 // to produce JSON. If no MarshalJSON method is present but the
 // value implements encoding.TextMarshaler instead, Marshal calls
@@ -84,11 +91,16 @@ import (
 //
 // Struct values encode as JSON objects. Each exported struct field
 // becomes a member of the object unless
-//   - the field's tag is "-", or
-//   - the field is empty and its tag specifies the "omitempty" option.
+//   - the field's tag is "-",
+//   - the field is empty and its tag specifies the "omitempty" option, or
+//   - the field is zero and its tag specifies the "omitzero" option.
 // The empty values are false, 0, any
 // nil pointer or interface value, and any array, slice, map, or string of
-// length zero. The object's default key string is the struct field name
+// length zero. The zero values are those for which an "IsZero() bool"
+// method of the field returns true, or in the absence of such a method,
+// the zero value of the field's type (so that e.g. an empty struct or
+// time.Time{} is zero, but an empty non-nil slice is not).
+// The object's default key string is the struct field name
 // but can be specified in the struct field's tag value. The "json" key in
 // the struct field's tag value is the key name, followed by an optional comma
 // and options. Examples:
@@ -109,6 +121,10 @@ import (
 //   // Note the leading comma.
 //   Field int `json:",omitempty"`
 //
+//   // Field appears in JSON as key "myTime", but the field is
+//   // skipped if its IsZero method returns true.
+//   Field time.Time `json:"myTime,omitzero"`
+//
 // The "string" option signals that a field is stored as JSON inside a
 // JSON-encoded string. It applies only to fields of string, floating point,
 // integer, or boolean types. This extra level of encoding is sometimes used
@@ -120,6 +136,25 @@ import (
 // only Unicode letters, digits, dollar signs, percent signs, hyphens,
 // underscores and slashes.
 //
+// The "inline" option applies to a field of map type with string keys, whose
+// entries become members of the enclosing object (merged in sorted order with
+// the other fields) rather than the field becoming a member itself. Marshal
+// returns an UnsupportedValueError if a map key is the key of another field.
+// Unmarshal stores members whose keys are not exactly those of other fields
+// (even if they match case-insensitively) in the map:
+//
+//   Extra map[string]RawMessage `json:",inline"`
+//
+// The "set" option applies to a field of slice or array type (other than
+// []byte) without its own marshaling methods, and sorts the elements of the
+// resulting JSON array by their encodings, so that e.g. a list of roles
+// encodes the same regardless of the order in which they were added.
+// Adding the "unique" option as well makes Marshal return a
+// DuplicateElementError for duplicate elements. Unmarshal is unaffected.
+// SortedArray provides the same encoding outside of a struct:
+//
+//   Roles []string `json:"roles,set,unique"`
+//
 // Anonymous struct fields are usually marshaled as if their inner exported fields
 // were fields in the outer struct, subject to the usual Go visibility rules amended
 // as described in the next paragraph.
@@ -163,12 +198,28 @@ import (
 // an infinite recursion.
 //
 func Marshal(v interface{}) ([]byte, error) {
-	e := &encodeState{}
+	return AppendMarshal(nil, v)
+}
+
+// AppendMarshal appends the canonical UTF-8 JSON encoding of v to dst
+// and returns the extended buffer, or dst unchanged if encoding fails.
+// See the documentation for Marshal for details about the conversion of
+// Go values to JSON.
+func AppendMarshal(dst []byte, v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	return appendEncoding(dst, valueEncoder(rv), rv, false)
+}
+
+// MarshalTo writes the canonical UTF-8 JSON encoding of v to w. Nothing
+// is written if encoding fails.
+func MarshalTo(w io.Writer, v interface{}) error {
+	e := newEncodeState()
 	err := e.marshal(v)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		_, err = w.Write(e.Bytes())
 	}
-	return e.Bytes(), nil
+	encodeStatePool.Put(e)
+	return err
 }
 
 // MarshalIndent is like Marshal, but adds whitespace for more readable output.
@@ -191,6 +242,56 @@ type Marshaler interface {
 	MarshalJSON() ([]byte, error)
 }
 
+// AppendMarshaler is the interface implemented by types that can append
+// their own canonical JSON encoding to a byte slice, such as those with
+// methods generated by canonicaljson-gen. Unlike the output of
+// MarshalJSON, the appended bytes are trusted to be canonical and are
+// used without being parsed again. Marshal returns an error from
+// AppendCanonicalJSON wrapped in a MarshalerError, whose Unwrap method
+// (and hence errors.Is and errors.As) reaches the original error.
+type AppendMarshaler interface {
+	AppendCanonicalJSON(dst []byte) ([]byte, error)
+}
+
+// CanonicalMarshaler is the interface implemented by types that can
+// marshal themselves into canonical JSON. Unlike the output of
+// MarshalJSON, the returned bytes are trusted to be canonical and are
+// used without being parsed again.
+type CanonicalMarshaler interface {
+	MarshalCanonicalJSON() ([]byte, error)
+}
+
+// AppendString appends the canonical JSON encoding of s to dst. If quoted
+// is true, s is encoded twice, as for a struct field with the "string"
+// option.
+func AppendString(dst []byte, s string, quoted bool) ([]byte, error) {
+	return appendEncoding(dst, stringEncoder, reflect.ValueOf(s), quoted)
+}
+
+// AppendFloat appends the canonical JSON encoding of f, a floating-point
+// value of bitSize bits (32 or 64), to dst. If quoted is true, the
+// encoding is wrapped in a string, as for a struct field with the
+// "string" option.
+func AppendFloat(dst []byte, f float64, bitSize int, quoted bool) ([]byte, error) {
+	return appendEncoding(dst, floatEncoder(bitSize).encode, reflect.ValueOf(f), quoted)
+}
+
+// AppendNumber appends the canonical JSON encoding of the number literal
+// n to dst.
+func AppendNumber(dst []byte, n Number) ([]byte, error) {
+	return appendEncoding(dst, stringEncoder, reflect.ValueOf(n), false)
+}
+
+func appendEncoding(dst []byte, enc encoderFunc, v reflect.Value, quoted bool) ([]byte, error) {
+	e := newEncodeState()
+	err := e.encode(enc, v, quoted)
+	if err == nil {
+		dst = append(dst, e.Bytes()...)
+	}
+	encodeStatePool.Put(e)
+	return dst, err
+}
+
 // An UnsupportedTypeError is returned by Marshal when attempting
 // to encode an unsupported value type.
 type UnsupportedTypeError struct {
@@ -211,14 +312,22 @@ func (e *UnsupportedValueError) Error() string {
 }
 
 type MarshalerError struct {
-	Type reflect.Type
-	Err  error
+	Type       reflect.Type
+	Err        error
+	sourceFunc string
 }
 
 func (e *MarshalerError) Error() string {
-	return "canonicaljson: error calling MarshalJSON for type " + e.Type.String() + ": " + e.Err.Error()
+	srcFunc := e.sourceFunc
+	if srcFunc == "" {
+		srcFunc = "MarshalJSON"
+	}
+	return "canonicaljson: error calling " + srcFunc + " for type " + e.Type.String() + ": " + e.Err.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e *MarshalerError) Unwrap() error { return e.Err }
+
 var hex = "0123456789ABCDEF"
 var jsonNumberType = reflect.TypeOf(json.Number(""))
 
@@ -226,6 +335,14 @@ var jsonNumberType = reflect.TypeOf(json.Number(""))
 type encodeState struct {
 	bytes.Buffer // accumulated output
 	scratch      [64]byte
+
+	// Number of goroutines for encoding large arrays and maps (see
+	// Encoder.SetParallelism), or 0 to encode serially.
+	parallelism int
+
+	// Whether to check the output of trusted marshalers (see
+	// Encoder.SetVerifyMarshalers).
+	verify bool
 }
 
 var encodeStatePool sync.Pool
@@ -234,12 +351,20 @@ func newEncodeState() *encodeState {
 	if v := encodeStatePool.Get(); v != nil {
 		e := v.(*encodeState)
 		e.Reset()
+		e.parallelism = 0
+		e.verify = false
 		return e
 	}
 	return new(encodeState)
 }
 
-func (e *encodeState) marshal(v interface{}) (err error) {
+func (e *encodeState) marshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	return e.encode(valueEncoder(rv), rv, false)
+}
+
+// encode writes v to e using enc, recovering any error that aborts it.
+func (e *encodeState) encode(enc encoderFunc, v reflect.Value, quoted bool) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
@@ -251,7 +376,7 @@ func (e *encodeState) marshal(v interface{}) (err error) {
 			err = r.(error)
 		}
 	}()
-	e.reflectValue(reflect.ValueOf(v))
+	enc(e, v, quoted)
 	return nil
 }
 
@@ -283,9 +408,24 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 
 type encoderFunc func(e *encodeState, v reflect.Value, quoted bool)
 
+// encoderCache maps types to their encoderFuncs. Reads are lock-free;
+// writers copy the map under mu and store the copy.
 var encoderCache struct {
-	sync.RWMutex
-	m map[reflect.Type]encoderFunc
+	value atomic.Value // map[reflect.Type]encoderFunc
+	mu    sync.Mutex   // used only by writers
+}
+
+// cacheEncoder stores f as the encoderFunc for t.
+func cacheEncoder(t reflect.Type, f encoderFunc) {
+	encoderCache.mu.Lock()
+	m, _ := encoderCache.value.Load().(map[reflect.Type]encoderFunc)
+	newM := make(map[reflect.Type]encoderFunc, len(m)+1)
+	for k, v := range m {
+		newM[k] = v
+	}
+	newM[t] = f
+	encoderCache.value.Store(newM)
+	encoderCache.mu.Unlock()
 }
 
 func valueEncoder(v reflect.Value) encoderFunc {
@@ -296,9 +436,8 @@ func valueEncoder(v reflect.Value) encoderFunc {
 }
 
 func typeEncoder(t reflect.Type) encoderFunc {
-	encoderCache.RLock()
-	f := encoderCache.m[t]
-	encoderCache.RUnlock()
+	m, _ := encoderCache.value.Load().(map[reflect.Type]encoderFunc)
+	f := m[t]
 	if f != nil {
 		return f
 	}
@@ -307,36 +446,49 @@ func typeEncoder(t reflect.Type) encoderFunc {
 	// indirect func before we build it. This type waits on the
 	// real func (f) to be ready and then calls it. This indirect
 	// func is only used for recursive types.
-	encoderCache.Lock()
-	if encoderCache.m == nil {
-		encoderCache.m = make(map[reflect.Type]encoderFunc)
-	}
 	var wg sync.WaitGroup
 	wg.Add(1)
-	encoderCache.m[t] = func(e *encodeState, v reflect.Value, quoted bool) {
+	cacheEncoder(t, func(e *encodeState, v reflect.Value, quoted bool) {
 		wg.Wait()
 		f(e, v, quoted)
-	}
-	encoderCache.Unlock()
+	})
 
 	// Compute fields without lock.
 	// Might duplicate effort but won't hold other computations back.
 	f = newTypeEncoder(t, true)
 	wg.Done()
-	encoderCache.Lock()
-	encoderCache.m[t] = f
-	encoderCache.Unlock()
+	cacheEncoder(t, f)
 	return f
 }
 
 var (
-	marshalerType     = reflect.TypeOf(new(json.Marshaler)).Elem()
-	textMarshalerType = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	appendMarshalerType    = reflect.TypeOf(new(AppendMarshaler)).Elem()
+	canonicalMarshalerType = reflect.TypeOf(new(CanonicalMarshaler)).Elem()
+	marshalerType          = reflect.TypeOf(new(json.Marshaler)).Elem()
+	textMarshalerType      = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
 )
 
 // newTypeEncoder constructs an encoderFunc for a type.
 // The returned encoder only checks CanAddr when allowAddr is true.
 func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	if t.Implements(appendMarshalerType) {
+		return appendMarshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(appendMarshalerType) {
+			return newCondAddrEncoder(addrAppendMarshalerEncoder, newTypeEncoder(t, false))
+		}
+	}
+
+	if t.Implements(canonicalMarshalerType) {
+		return canonicalMarshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr {
+		if reflect.PtrTo(t).Implements(canonicalMarshalerType) {
+			return newCondAddrEncoder(addrCanonicalMarshalerEncoder, newTypeEncoder(t, false))
+		}
+	}
+
 	if t.Implements(marshalerType) {
 		return marshalerEncoder
 	}
@@ -389,6 +541,72 @@ func invalidValueEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	e.WriteString("null")
 }
 
+func appendMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m := v.Interface().(AppendMarshaler)
+	b, err := m.AppendCanonicalJSON(e.scratch[:0])
+	if err == nil && e.verify {
+		err = CheckCanonical(b)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "AppendCanonicalJSON"})
+	}
+	e.Write(b)
+}
+
+func addrAppendMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m := va.Interface().(AppendMarshaler)
+	b, err := m.AppendCanonicalJSON(e.scratch[:0])
+	if err == nil && e.verify {
+		err = CheckCanonical(b)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "AppendCanonicalJSON"})
+	}
+	e.Write(b)
+}
+
+func canonicalMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m := v.Interface().(CanonicalMarshaler)
+	b, err := m.MarshalCanonicalJSON()
+	if err == nil && e.verify {
+		err = CheckCanonical(b)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "MarshalCanonicalJSON"})
+	}
+	e.Write(b)
+}
+
+func addrCanonicalMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m := va.Interface().(CanonicalMarshaler)
+	b, err := m.MarshalCanonicalJSON()
+	if err == nil && e.verify {
+		err = CheckCanonical(b)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "MarshalCanonicalJSON"})
+	}
+	e.Write(b)
+}
+
 func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	if v.Kind() == reflect.Ptr && v.IsNil() {
 		e.WriteString("null")
@@ -410,7 +628,7 @@ func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 		e.Buffer.Write(jsonBlob)
 	}
 	if err != nil {
-		e.error(&MarshalerError{v.Type(), err})
+		e.error(&MarshalerError{v.Type(), err, "MarshalJSON"})
 	}
 }
 
@@ -436,7 +654,7 @@ func addrMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 		e.Buffer.Write(jsonBlob)
 	}
 	if err != nil {
-		e.error(&MarshalerError{v.Type(), err})
+		e.error(&MarshalerError{v.Type(), err, "MarshalJSON"})
 	}
 }
 
@@ -448,7 +666,7 @@ func textMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	m := v.Interface().(encoding.TextMarshaler)
 	b, err := m.MarshalText()
 	if err != nil {
-		e.error(&MarshalerError{v.Type(), err})
+		e.error(&MarshalerError{v.Type(), err, "MarshalText"})
 	}
 	e.stringBytes(b)
 }
@@ -462,7 +680,7 @@ func addrTextMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	m := va.Interface().(encoding.TextMarshaler)
 	b, err := m.MarshalText()
 	if err != nil {
-		e.error(&MarshalerError{v.Type(), err})
+		e.error(&MarshalerError{v.Type(), err, "MarshalText"})
 	}
 	e.stringBytes(b)
 }
@@ -585,6 +803,15 @@ func normalizeNumber(e *encodeState, stringBytes []byte) {
 	}
 }
 
+// canonicalNumber returns the canonical form of valid JSON number s.
+func canonicalNumber(s []byte) string {
+	e := newEncodeState()
+	normalizeNumber(e, s)
+	c := e.String()
+	encodeStatePool.Put(e)
+	return c
+}
+
 type floatEncoder int // number of bits
 
 func (bits floatEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
@@ -641,38 +868,88 @@ func unsupportedTypeEncoder(e *encodeState, v reflect.Value, quoted bool) {
 }
 
 type structEncoder struct {
-	fields    []field
+	fields    []fields.Field
 	fieldEncs []encoderFunc
+	inline    *fields.Field // the ",inline" field, if any
+	inlineEnc encoderFunc   // encoder for the elements of inline
 }
 
 func (se *structEncoder) encode(e *encodeState, v reflect.Value, quoted bool) {
+	// Members of an inline map are merged with the other fields in
+	// sorted order, so long as none of them would decode into a field.
+	// Each is copied into an addressable elem first, so that e.g. a
+	// RawMessage member is not mistaken for a []byte.
+	var extra, elem reflect.Value
+	var keys stringValues
+	if se.inline != nil {
+		extra = fields.FieldByIndex(v, se.inline.Index)
+		if extra.IsValid() && extra.Len() > 0 {
+			elem = reflect.New(extra.Type().Elem()).Elem()
+			keys = extra.MapKeys()
+			sort.Sort(keys)
+			for _, k := range keys {
+				if fields.LookupExact(se.fields, []byte(k.String())) != nil {
+					e.error(&UnsupportedValueError{extra, "inline member " + strconv.Quote(k.String()) + " collides with a struct field"})
+				}
+			}
+		}
+	}
+
 	e.WriteByte('{')
 	first := true
 	for i, f := range se.fields {
-		fv := fieldByIndex(v, f.index)
-		if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
+		if f.Inline {
 			continue
 		}
-		if first {
-			first = false
-		} else {
-			e.WriteByte(',')
+		fv := fields.FieldByIndex(v, f.Index)
+		if !fv.IsValid() || f.OmitEmpty && isEmptyValue(fv) || f.OmitZero && f.IsZero(fv) {
+			continue
 		}
-		e.string(f.name)
-		e.WriteByte(':')
-		se.fieldEncs[i](e, fv, f.quoted)
+		for ; len(keys) > 0 && keys.get(0) < f.Name; keys = keys[1:] {
+			e.member(&first, keys.get(0))
+			elem.Set(extra.MapIndex(keys[0]))
+			se.inlineEnc(e, elem, false)
+		}
+		e.member(&first, f.Name)
+		se.fieldEncs[i](e, fv, f.Quoted)
+	}
+	for _, k := range keys {
+		e.member(&first, k.String())
+		elem.Set(extra.MapIndex(k))
+		se.inlineEnc(e, elem, false)
 	}
 	e.WriteByte('}')
 }
 
+// member writes the key of an object member, preceded by a comma unless
+// *first is true, in which case it is cleared.
+func (e *encodeState) member(first *bool, name string) {
+	if *first {
+		*first = false
+	} else {
+		e.WriteByte(',')
+	}
+	e.string(name)
+	e.WriteByte(':')
+}
+
 func newStructEncoder(t reflect.Type) encoderFunc {
-	fields := cachedTypeFields(t)
+	fs := fields.CachedTypeFields(t)
 	se := &structEncoder{
-		fields:    fields,
-		fieldEncs: make([]encoderFunc, len(fields)),
+		fields:    fs,
+		fieldEncs: make([]encoderFunc, len(fs)),
+		inline:    fields.Inline(fs),
 	}
-	for i, f := range fields {
-		se.fieldEncs[i] = typeEncoder(typeByIndex(t, f.index))
+	for i, f := range fs {
+		if f.Inline {
+			se.inlineEnc = typeEncoder(f.Type.Elem())
+			continue
+		}
+		if f.Set {
+			se.fieldEncs[i] = newSetEncoder(f.Type, f.Unique)
+			continue
+		}
+		se.fieldEncs[i] = typeEncoder(fields.TypeByIndex(t, f.Index))
 	}
 	return se.encode
 }
@@ -687,19 +964,36 @@ func (me *mapEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
 		return
 	}
 	e.WriteByte('{')
-	var sv stringValues = v.MapKeys()
-	sort.Sort(sv)
-	for i, k := range sv {
-		if i > 0 {
-			e.WriteByte(',')
-		}
-		e.string(k.String())
+	keys := v.MapKeys()
+	sv := make([]reflectWithString, len(keys))
+	for i, k := range keys {
+		sv[i] = reflectWithString{k, k.String()}
+	}
+	sort.Slice(sv, func(i, j int) bool { return sv[i].s < sv[j].s })
+	member := func(e *encodeState, i int) {
+		e.string(sv[i].s)
 		e.WriteByte(':')
-		me.elemEnc(e, v.MapIndex(k), false)
+		me.elemEnc(e, v.MapIndex(sv[i].v), false)
+	}
+	if e.parallelism > 1 && len(sv) >= minParallelElems {
+		e.parallelElems(len(sv), member)
+	} else {
+		for i := range sv {
+			if i > 0 {
+				e.WriteByte(',')
+			}
+			member(e, i)
+		}
 	}
 	e.WriteByte('}')
 }
 
+// reflectWithString is a map key along with its string value.
+type reflectWithString struct {
+	v reflect.Value
+	s string
+}
+
 func newMapEncoder(t reflect.Type) encoderFunc {
 	if t.Key().Kind() != reflect.String {
 		return unsupportedTypeEncoder
@@ -759,15 +1053,62 @@ type arrayEncoder struct {
 func (ae *arrayEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
 	e.WriteByte('[')
 	n := v.Len()
-	for i := 0; i < n; i++ {
-		if i > 0 {
-			e.WriteByte(',')
+	if e.parallelism > 1 && n >= minParallelElems {
+		e.parallelElems(n, func(e *encodeState, i int) {
+			ae.elemEnc(e, v.Index(i), false)
+		})
+	} else {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				e.WriteByte(',')
+			}
+			ae.elemEnc(e, v.Index(i), false)
 		}
-		ae.elemEnc(e, v.Index(i), false)
 	}
 	e.WriteByte(']')
 }
 
+// minParallelElems is the least number of elements in an array or map
+// that is worth encoding in parallel.
+const minParallelElems = 1024
+
+// parallelElems writes the comma-separated encodings of n elements of an
+// array or map, written by elem, to e. It divides them into consecutive
+// chunks encoded concurrently into separate encodeStates (which encode
+// serially), and then writes those in order, so that the output is as if
+// elem had been called for each element in turn. Likewise, if encoding
+// any element fails, it panics with the failure of the first one.
+func (e *encodeState) parallelElems(n int, elem func(e *encodeState, i int)) {
+	chunks := make([]*encodeState, e.parallelism)
+	failures := make([]interface{}, len(chunks))
+	var wg sync.WaitGroup
+	for c := range chunks {
+		ce := newEncodeState()
+		ce.verify = e.verify
+		chunks[c] = ce
+		lo, hi := n*c/len(chunks), n*(c+1)/len(chunks)
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			defer func() { failures[c] = recover() }()
+			for i := lo; i < hi; i++ {
+				if i > 0 {
+					ce.WriteByte(',')
+				}
+				elem(ce, i)
+			}
+		}(c)
+	}
+	wg.Wait()
+	for c, ce := range chunks {
+		if failures[c] != nil {
+			panic(failures[c])
+		}
+		e.Write(ce.Bytes())
+		encodeStatePool.Put(ce)
+	}
+}
+
 func newArrayEncoder(t reflect.Type) encoderFunc {
 	enc := &arrayEncoder{typeEncoder(t.Elem())}
 	return enc.encode
@@ -809,48 +1150,6 @@ func newCondAddrEncoder(canAddrEnc, elseEnc encoderFunc) encoderFunc {
 	return enc.encode
 }
 
-func isValidTag(s string) bool {
-	if s == "" {
-		return false
-	}
-	for _, c := range s {
-		switch {
-		case strings.ContainsRune("!#$%&()*+-./:<=>?@[]^_{|}~ ", c):
-			// Backslash and quote chars are reserved, but
-			// otherwise any punctuation chars are allowed
-			// in a tag name.
-		default:
-			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
-				return false
-			}
-		}
-	}
-	return true
-}
-
-func fieldByIndex(v reflect.Value, index []int) reflect.Value {
-	for _, i := range index {
-		if v.Kind() == reflect.Ptr {
-			if v.IsNil() {
-				return reflect.Value{}
-			}
-			v = v.Elem()
-		}
-		v = v.Field(i)
-	}
-	return v
-}
-
-func typeByIndex(t reflect.Type, index []int) reflect.Type {
-	for _, i := range index {
-		if t.Kind() == reflect.Ptr {
-			t = t.Elem()
-		}
-		t = t.Field(i).Type
-	}
-	return t
-}
-
 // stringValues is a slice of reflect.Value holding *reflect.StringValue.
 // It implements the methods to sort by string.
 type stringValues []reflect.Value
@@ -942,262 +1241,3 @@ func (e *encodeState) stringBytes(s []byte) int {
 	e.WriteByte('"')
 	return e.Len() - len0
 }
-
-// A field represents a single field found in a struct.
-type field struct {
-	name      string
-	nameBytes []byte                 // []byte(name)
-	equalFold func(s, t []byte) bool // bytes.EqualFold or equivalent
-
-	tag       bool
-	index     []int
-	typ       reflect.Type
-	omitEmpty bool
-	quoted    bool
-}
-
-func fillField(f field) field {
-	f.nameBytes = []byte(f.name)
-	f.equalFold = foldFunc(f.nameBytes)
-	return f
-}
-
-// byName sorts field by name, breaking ties with depth,
-// then breaking ties with "name came from json tag", then
-// breaking ties with index sequence.
-type byName []field
-
-func (x byName) Len() int { return len(x) }
-
-func (x byName) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
-
-func (x byName) Less(i, j int) bool {
-	if x[i].name != x[j].name {
-		return x[i].name < x[j].name
-	}
-	if len(x[i].index) != len(x[j].index) {
-		return len(x[i].index) < len(x[j].index)
-	}
-	if x[i].tag != x[j].tag {
-		return x[i].tag
-	}
-	return byIndex(x).Less(i, j)
-}
-
-// byIndex sorts field by index sequence.
-type byIndex []field
-
-func (x byIndex) Len() int { return len(x) }
-
-func (x byIndex) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
-
-func (x byIndex) Less(i, j int) bool {
-	for k, xik := range x[i].index {
-		if k >= len(x[j].index) {
-			return false
-		}
-		if xik != x[j].index[k] {
-			return xik < x[j].index[k]
-		}
-	}
-	return len(x[i].index) < len(x[j].index)
-}
-
-// typeFields returns a list of fields that JSON should recognize for the given type.
-// The algorithm is breadth-first search over the set of structs to include - the top struct
-// and then any reachable anonymous structs.
-func typeFields(t reflect.Type) []field {
-	// Anonymous fields to explore at the current level and the next.
-	current := []field{}
-	next := []field{{typ: t}}
-
-	// Count of queued names for current level and the next.
-	count := map[reflect.Type]int{}
-	nextCount := map[reflect.Type]int{}
-
-	// Types already visited at an earlier level.
-	visited := map[reflect.Type]bool{}
-
-	// Fields found.
-	var fields []field
-
-	for len(next) > 0 {
-		current, next = next, current[:0]
-		count, nextCount = nextCount, map[reflect.Type]int{}
-
-		for _, f := range current {
-			if visited[f.typ] {
-				continue
-			}
-			visited[f.typ] = true
-
-			// Scan f.typ for fields to include.
-			for i := 0; i < f.typ.NumField(); i++ {
-				sf := f.typ.Field(i)
-				if sf.PkgPath != "" && !sf.Anonymous { // unexported
-					continue
-				}
-				tag := sf.Tag.Get("json")
-				if tag == "-" {
-					continue
-				}
-				name, opts := parseTag(tag)
-				if !isValidTag(name) {
-					name = ""
-				}
-				index := make([]int, len(f.index)+1)
-				copy(index, f.index)
-				index[len(f.index)] = i
-
-				ft := sf.Type
-				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
-					// Follow pointer.
-					ft = ft.Elem()
-				}
-
-				// Only strings, floats, integers, and booleans can be quoted.
-				quoted := false
-				if opts.Contains("string") {
-					switch ft.Kind() {
-					case reflect.Bool,
-						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-						reflect.Float32, reflect.Float64,
-						reflect.String:
-						quoted = true
-					}
-				}
-
-				// Record found field and index sequence.
-				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
-					tagged := name != ""
-					if name == "" {
-						name = sf.Name
-					}
-					fields = append(fields, fillField(field{
-						name:      name,
-						tag:       tagged,
-						index:     index,
-						typ:       ft,
-						omitEmpty: opts.Contains("omitempty"),
-						quoted:    quoted,
-					}))
-					if count[f.typ] > 1 {
-						// If there were multiple instances, add a second,
-						// so that the annihilation code will see a duplicate.
-						// It only cares about the distinction between 1 or 2,
-						// so don't bother generating any more copies.
-						fields = append(fields, fields[len(fields)-1])
-					}
-					continue
-				}
-
-				// Record new anonymous struct to explore in next round.
-				nextCount[ft]++
-				if nextCount[ft] == 1 {
-					next = append(next, fillField(field{name: ft.Name(), index: index, typ: ft}))
-				}
-			}
-		}
-	}
-
-	sort.Sort(byName(fields))
-
-	// Delete all fields that are hidden by the Go rules for embedded fields,
-	// except that fields with JSON tags are promoted.
-
-	// The fields are sorted in primary order of name, secondary order
-	// of field index length. Loop over names; for each name, delete
-	// hidden fields by choosing the one dominant field that survives.
-	out := fields[:0]
-	for advance, i := 0, 0; i < len(fields); i += advance {
-		// One iteration per name.
-		// Find the sequence of fields with the name of this first field.
-		fi := fields[i]
-		name := fi.name
-		for advance = 1; i+advance < len(fields); advance++ {
-			fj := fields[i+advance]
-			if fj.name != name {
-				break
-			}
-		}
-		if advance == 1 { // Only one field with this name
-			out = append(out, fi)
-			continue
-		}
-		dominant, ok := dominantField(fields[i : i+advance])
-		if ok {
-			out = append(out, dominant)
-		}
-	}
-
-	return out
-}
-
-// dominantField looks through the fields, all of which are known to
-// have the same name, to find the single field that dominates the
-// others using Go's embedding rules, modified by the presence of
-// JSON tags. If there are multiple top-level fields, the boolean
-// will be false: This condition is an error in Go and we skip all
-// the fields.
-func dominantField(fields []field) (field, bool) {
-	// The fields are sorted in increasing index-length order. The winner
-	// must therefore be one with the shortest index length. Drop all
-	// longer entries, which is easy: just truncate the slice.
-	length := len(fields[0].index)
-	tagged := -1 // Index of first tagged field.
-	for i, f := range fields {
-		if len(f.index) > length {
-			fields = fields[:i]
-			break
-		}
-		if f.tag {
-			if tagged >= 0 {
-				// Multiple tagged fields at the same level: conflict.
-				// Return no field.
-				return field{}, false
-			}
-			tagged = i
-		}
-	}
-	if tagged >= 0 {
-		return fields[tagged], true
-	}
-	// All remaining fields have the same length. If there's more than one,
-	// we have a conflict (two fields named "X" at the same level) and we
-	// return no field.
-	if len(fields) > 1 {
-		return field{}, false
-	}
-	return fields[0], true
-}
-
-var fieldCache struct {
-	sync.RWMutex
-	m map[reflect.Type][]field
-}
-
-// cachedTypeFields is like typeFields but uses a cache to avoid repeated work.
-func cachedTypeFields(t reflect.Type) []field {
-	fieldCache.RLock()
-	f := fieldCache.m[t]
-	fieldCache.RUnlock()
-	if f != nil {
-		return f
-	}
-
-	// Compute fields without lock.
-	// Might duplicate effort but won't hold other computations back.
-	f = typeFields(t)
-	if f == nil {
-		f = []field{}
-	}
-
-	fieldCache.Lock()
-	if fieldCache.m == nil {
-		fieldCache.m = map[reflect.Type][]field{}
-	}
-	fieldCache.m[t] = f
-	fieldCache.Unlock()
-	return f
-}
@@ -8,11 +8,14 @@ package canonicaljson
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 	"unicode"
 )
 
@@ -70,6 +73,154 @@ func TestOmitEmpty(t *testing.T) {
 	}
 }
 
+type NonZeroStruct struct{}
+
+func (NonZeroStruct) IsZero() bool { return false }
+
+type NoPanicStruct struct {
+	Int int
+}
+
+func (nps *NoPanicStruct) IsZero() bool { return nps.Int != 0 }
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+type OptionalsZero struct {
+	Sr string `json:"sr"`
+	So string `json:"so,omitzero"`
+	Sw string `json:"-"`
+
+	Ir int `json:"omitzero"` // actually named omitzero, not an option
+	Io int `json:"io,omitzero"`
+
+	Slr       []string `json:"slr,random"`
+	Slo       []string `json:"slo,omitzero"`
+	SloNonNil []string `json:"slononnil,omitzero"`
+
+	Mr  map[string]interface{} `json:"mr"`
+	Mo  map[string]interface{} `json:",omitzero"`
+	Moo map[string]interface{} `json:"moo,omitzero"`
+
+	Fr   float64    `json:"fr"`
+	Fo   float64    `json:"fo,omitzero"`
+	Foo  float64    `json:"foo,omitzero"`
+	Foo2 [2]float64 `json:"foo2,omitzero"`
+
+	Br bool `json:"br"`
+	Bo bool `json:"bo,omitzero"`
+
+	Ur uint `json:"ur"`
+	Uo uint `json:"uo,omitzero"`
+
+	Str struct{} `json:"str"`
+	Sto struct{} `json:"sto,omitzero"`
+
+	Time      time.Time     `json:"time,omitzero"`
+	TimeLocal time.Time     `json:"timelocal,omitzero"`
+	Nzs       NonZeroStruct `json:"nzs,omitzero"`
+	Nps       NoPanicStruct `json:"nps,omitzero"`
+
+	NilIsZeroer    isZeroer       `json:"niliszeroer,omitzero"`    // nil interface
+	NonNilIsZeroer isZeroer       `json:"nonniliszeroer,omitzero"` // non-nil interface
+	NoPanicStruct0 isZeroer       `json:"nps0,omitzero"`           // non-nil interface with nil pointer
+	NoPanicStruct1 isZeroer       `json:"nps1,omitzero"`           // non-nil interface with non-nil pointer
+	NoPanicStruct2 *NoPanicStruct `json:"nps2,omitzero"`           // nil pointer
+	NoPanicStruct3 *NoPanicStruct `json:"nps3,omitzero"`           // non-nil pointer
+
+	Both  string `json:"both,omitempty,omitzero"`
+	Both2 []int  `json:"both2,omitempty,omitzero"`
+}
+
+var optionalsZeroExpected = `{
+ "Mo": {},
+ "br": false,
+ "fr": 0,
+ "mr": {},
+ "nps": {
+  "Int": 0
+ },
+ "nps1": {
+  "Int": 0
+ },
+ "nps3": {
+  "Int": 0
+ },
+ "nzs": {},
+ "omitzero": 0,
+ "slononnil": [],
+ "slr": null,
+ "sr": "",
+ "str": {},
+ "ur": 0
+}`
+
+func TestOmitZero(t *testing.T) {
+	var o OptionalsZero
+	o.Sw = "something"
+	o.SloNonNil = make([]string, 0)
+	o.Mr = map[string]interface{}{}
+	o.Mo = map[string]interface{}{}
+	o.Foo = math.Copysign(0, -1) // negative zero is zero
+	o.Foo2 = [2]float64{0, math.Copysign(0, -1)}
+	o.TimeLocal = time.Time{}.Local()
+	o.NonNilIsZeroer = time.Time{}
+	o.NoPanicStruct0 = (*NoPanicStruct)(nil)
+	o.NoPanicStruct1 = &NoPanicStruct{}
+	o.NoPanicStruct3 = &NoPanicStruct{}
+	o.Both2 = []int{}
+
+	for _, v := range []interface{}{o, &o} {
+		got, err := MarshalIndent(v, "", " ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(got); got != optionalsZeroExpected {
+			t.Errorf("MarshalIndent(%T):\n got: %s\nwant: %s\n", v, got, optionalsZeroExpected)
+		}
+	}
+}
+
+type Inline struct {
+	B     int                    `json:"b"`
+	D     string                 `json:"d,omitempty"`
+	Extra map[string]interface{} `json:",inline"`
+}
+
+func TestInline(t *testing.T) {
+	for _, tt := range []struct {
+		in   Inline
+		want string
+	}{
+		{Inline{B: 1}, `{"b":1}`},
+		{Inline{B: 1, Extra: map[string]interface{}{}}, `{"b":1}`},
+		{
+			Inline{B: 1, D: "x", Extra: map[string]interface{}{"e": []int{1}, "c": nil, "a": true, "": 0}},
+			`{"":0,"a":true,"b":1,"c":null,"d":"x","e":[1]}`,
+		},
+		{Inline{B: 1, Extra: map[string]interface{}{"B": 2, "D": "y"}}, `{"B":2,"D":"y","b":1}`},
+	} {
+		got, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tt.in, err)
+		} else if string(got) != tt.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	// Members named exactly as a field are rejected, even if the field
+	// itself is omitted.
+	for _, key := range []string{"b", "d"} {
+		v := Inline{Extra: map[string]interface{}{key: 1}}
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(%#v): expected error", v)
+		} else if _, ok := err.(*UnsupportedValueError); !ok {
+			t.Errorf("Marshal(%#v): got error %T, want *UnsupportedValueError", v, err)
+		}
+	}
+}
+
 type StringTag struct {
 	BoolStr bool   `json:",string"`
 	IntStr  int64  `json:",string"`
@@ -716,3 +867,355 @@ func TestFloat(t *testing.T) {
 		}
 	}
 }
+
+func TestAppendScalars(t *testing.T) {
+	prefix := []byte("x")
+	for _, tt := range encodeStringTests {
+		want, _ := Marshal(tt.in)
+		if got, err := AppendString(prefix, tt.in, false); err != nil || string(got) != "x"+string(want) {
+			t.Errorf("AppendString(%q) = %#q, %v; want %#q", tt.in, got, err, "x"+string(want))
+		}
+	}
+	if got, err := AppendString(prefix, `"`, true); err != nil || string(got) != `x"\"\\\"\""` {
+		t.Errorf("AppendString(quoted) = %#q, %v", got, err)
+	}
+	if _, err := AppendString(prefix, "\xff", false); err == nil {
+		t.Error("AppendString(invalid UTF-8): expected error")
+	}
+
+	for expected, inputs := range floats {
+		for _, input := range inputs {
+			f, _ := strconv.ParseFloat(input, 64)
+			if got, err := AppendFloat(prefix, f, 64, false); err != nil || string(got) != "x"+expected {
+				t.Errorf("AppendFloat(%s) = %#q, %v; want %#q", input, got, err, "x"+expected)
+			}
+			q, _ := Marshal(struct {
+				F float64 `json:",string"`
+			}{f})
+			want := "x" + string(q[len(`{"F":`):len(q)-1])
+			if got, err := AppendFloat(prefix, f, 64, true); err != nil || string(got) != want {
+				t.Errorf("AppendFloat(%s, quoted) = %#q, %v; want %#q", input, got, err, want)
+			}
+			if got, err := AppendNumber(prefix, Number(input)); err != nil || string(got) != "x"+expected {
+				t.Errorf("AppendNumber(%s) = %#q, %v; want %#q", input, got, err, "x"+expected)
+			}
+		}
+	}
+	if got, err := AppendFloat(prefix, 0.1, 32, false); err != nil || string(got) != "x1.0E-1" {
+		t.Errorf("AppendFloat(float32(0.1)) = %#q, %v", got, err)
+	}
+	if got, err := AppendFloat(prefix, math.NaN(), 64, false); err == nil || string(got) != "x" {
+		t.Errorf("AppendFloat(NaN) = %#q, %v; want error", got, err)
+	}
+	if _, err := AppendNumber(prefix, "1e"); err == nil {
+		t.Error("AppendNumber(1e): expected error")
+	}
+}
+
+// appendTag appends a fixed encoding, which Marshal trusts.
+type appendTag string
+
+func (a appendTag) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	if a == "" {
+		return nil, errors.New("empty appendTag")
+	}
+	return append(dst, `{"tag":`+string(a)+`}`...), nil
+}
+
+// addrAppendTag appends its encoding only when addressable.
+type addrAppendTag struct {
+	N int
+}
+
+func (a *addrAppendTag) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	if a.N < 0 {
+		return nil, errors.New("negative addrAppendTag")
+	}
+	return strconv.AppendInt(dst, int64(a.N), 10), nil
+}
+
+func TestAppendMarshaler(t *testing.T) {
+	v := struct {
+		A  appendTag
+		P  *appendTag
+		S  []addrAppendTag
+		V  addrAppendTag
+		PV *addrAppendTag
+	}{A: "1", S: []addrAppendTag{{2}}, V: addrAppendTag{3}, PV: &addrAppendTag{4}}
+	want := `{"A":{"tag":1},"P":null,"PV":4,"S":[2],"V":{"N":3}}`
+	if b, err := Marshal(v); err != nil || string(b) != want {
+		t.Errorf("Marshal = %#q, %v; want %#q", b, err, want)
+	}
+	want = `{"A":{"tag":1},"P":null,"PV":4,"S":[2],"V":3}`
+	if b, err := Marshal(&v); err != nil || string(b) != want {
+		t.Errorf("Marshal = %#q, %v; want %#q", b, err, want)
+	}
+
+	_, err := Marshal([]appendTag{""})
+	if merr, ok := err.(*MarshalerError); !ok || merr.Err.Error() != "empty appendTag" {
+		t.Errorf("Marshal error = %#v, want MarshalerError", err)
+	} else if want := "canonicaljson: error calling AppendCanonicalJSON for type canonicaljson.appendTag: empty appendTag"; err.Error() != want {
+		t.Errorf("Marshal error = %q, want %q", err, want)
+	}
+	_, err = Marshal([]addrAppendTag{{-1}})
+	if merr, ok := err.(*MarshalerError); !ok || merr.Unwrap() == nil || merr.Unwrap().Error() != "negative addrAppendTag" {
+		t.Errorf("Marshal error = %#v, want MarshalerError", err)
+	}
+}
+
+func TestAppendMarshal(t *testing.T) {
+	want, err := Marshal(named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := AppendMarshal([]byte("x"), named)
+	if err != nil || string(got) != "x"+string(want) {
+		t.Errorf("AppendMarshal = %#q, %v; want %#q", got, err, "x"+string(want))
+	}
+	got, err = AppendMarshal([]byte("x"), math.NaN())
+	if err == nil || string(got) != "x" {
+		t.Errorf("AppendMarshal(NaN) = %#q, %v; want %#q and error", got, err, "x")
+	}
+
+	var buf bytes.Buffer
+	if err := MarshalTo(&buf, named); err != nil || buf.String() != string(want) {
+		t.Errorf("MarshalTo wrote %#q, %v; want %#q", buf.Bytes(), err, want)
+	}
+	buf.Reset()
+	if err := MarshalTo(&buf, []interface{}{1, math.Inf(1)}); err == nil || buf.Len() != 0 {
+		t.Errorf("MarshalTo(Inf) wrote %#q, %v; want nothing and error", buf.Bytes(), err)
+	}
+
+	// Results of Marshal are not reused.
+	a, _ := Marshal("a")
+	if _, err := Marshal("bbbbbbbb"); err != nil || string(a) != `"a"` {
+		t.Errorf("Marshal result changed to %#q by a later call", a)
+	}
+}
+
+// benchValue is a small record of the kind typically marshaled in a loop.
+var benchValue = struct {
+	ID    int
+	Name  string
+	Tags  []string
+	Score float64
+	Flags struct{ A, B bool }
+}{42, "canonical", []string{"x", "y"}, 1.5, struct{ A, B bool }{true, false}}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(benchValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMarshalUnpooled encodes as Marshal did before using
+// encodeStatePool, for comparison.
+func BenchmarkMarshalUnpooled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e := &encodeState{}
+		if err := e.marshal(benchValue); err != nil {
+			b.Fatal(err)
+		}
+		_ = e.Bytes()
+	}
+}
+
+func BenchmarkAppendMarshal(b *testing.B) {
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendMarshal(buf[:0], benchValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalTo(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := MarshalTo(ioutil.Discard, benchValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// distinctTypeValues returns values of n distinct struct types, each
+// with a few fields (including a nested struct) so that encoding them
+// consults both the encoder and field caches.
+func distinctTypeValues(n int) []interface{} {
+	inner := reflect.TypeOf(struct {
+		A int
+		B string
+	}{})
+	values := make([]interface{}, n)
+	for i := range values {
+		t := reflect.StructOf([]reflect.StructField{
+			{Name: "ID", Type: reflect.TypeOf(0), Tag: reflect.StructTag(fmt.Sprintf(`json:"id%d"`, i))},
+			{Name: "Name", Type: reflect.TypeOf(""), Tag: `json:"name"`},
+			{Name: "Inner", Type: inner},
+			{Name: "List", Type: reflect.TypeOf([]float64(nil))},
+		})
+		v := reflect.New(t).Elem()
+		v.Field(0).SetInt(int64(i))
+		v.Field(1).SetString("value")
+		v.Field(3).Set(reflect.ValueOf([]float64{1, 2.5}))
+		values[i] = v.Interface()
+	}
+	return values
+}
+
+func TestMarshalConcurrentTypes(t *testing.T) {
+	values := distinctTypeValues(64)
+	errs := make(chan error, 8)
+	for g := 0; g < cap(errs); g++ {
+		go func(g int) {
+			for i := range values {
+				v := values[(i+g*8)%len(values)]
+				got, err := Marshal(v)
+				if err == nil {
+					want := fmt.Sprintf(`{"Inner":{"A":0,"B":""},"List":[1,2.5E0],"id%d":%[1]d,"name":"value"}`, reflect.ValueOf(v).Field(0).Int())
+					if string(got) != want {
+						err = fmt.Errorf("Marshal = %s, want %s", got, want)
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(g)
+	}
+	for g := 0; g < cap(errs); g++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// BenchmarkMarshalParallelTypes encodes many distinct types from all
+// goroutines at once, exercising concurrent reads of the type caches.
+func BenchmarkMarshalParallelTypes(b *testing.B) {
+	values := distinctTypeValues(256)
+	for _, v := range values {
+		if _, err := Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var buf []byte
+		for i := 0; pb.Next(); i++ {
+			var err error
+			if buf, err = AppendMarshal(buf[:0], values[i%len(values)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// trustedJSON marshals itself as is, without being checked.
+type trustedJSON string
+
+func (j trustedJSON) MarshalCanonicalJSON() ([]byte, error) {
+	if j == "" {
+		return nil, errors.New("empty trustedJSON")
+	}
+	return []byte(j), nil
+}
+
+// addrTrustedJSON marshals itself only when addressable.
+type addrTrustedJSON struct {
+	N int
+}
+
+func (j *addrTrustedJSON) MarshalCanonicalJSON() ([]byte, error) {
+	return []byte("[" + strconv.Itoa(j.N) + "]"), nil
+}
+
+func TestCanonicalMarshaler(t *testing.T) {
+	v := struct {
+		T  trustedJSON
+		P  *trustedJSON
+		A  addrTrustedJSON
+		PA *addrTrustedJSON
+	}{T: `{"b":1, "a":2}`, A: addrTrustedJSON{1}, PA: &addrTrustedJSON{2}}
+	want := `{"A":{"N":1},"P":null,"PA":[2],"T":{"b":1, "a":2}}`
+	if b, err := Marshal(v); err != nil || string(b) != want {
+		t.Errorf("Marshal = %#q, %v; want %#q", b, err, want)
+	}
+	want = `{"A":[1],"P":null,"PA":[2],"T":{"b":1, "a":2}}`
+	if b, err := Marshal(&v); err != nil || string(b) != want {
+		t.Errorf("Marshal = %#q, %v; want %#q", b, err, want)
+	}
+
+	_, err := Marshal(trustedJSON(""))
+	if merr, ok := err.(*MarshalerError); !ok || merr.Err.Error() != "empty trustedJSON" {
+		t.Errorf("Marshal error = %#v, want MarshalerError", err)
+	} else if want := "canonicaljson: error calling MarshalCanonicalJSON for type canonicaljson.trustedJSON: empty trustedJSON"; err.Error() != want {
+		t.Errorf("Marshal error = %q, want %q", err, want)
+	}
+}
+
+// verifiedMarshal is like Marshal, but checks the output of trusted
+// marshalers.
+func verifiedMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetVerifyMarshalers(true)
+	err := enc.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), err
+}
+
+func TestVerifyMarshalers(t *testing.T) {
+	for _, v := range []interface{}{
+		trustedJSON(`{"a":2,"b":[1.0E-1]}`),
+		&addrTrustedJSON{},
+		appendTag(`"x"`),
+	} {
+		if _, err := verifiedMarshal(v); err != nil {
+			t.Errorf("verifiedMarshal(%#v): %v", v, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		v   interface{}
+		err error
+	}{
+		{trustedJSON(`{"b":1,"a":2}`), &NonCanonicalError{2}},
+		{trustedJSON(`0.1`), &NonCanonicalError{0}},
+		{trustedJSON(`[`), &SyntaxError{"unexpected end of JSON input", 1}},
+		{appendTag(`1.0`), &NonCanonicalError{8}},
+	} {
+		_, err := verifiedMarshal(tt.v)
+		if merr, ok := err.(*MarshalerError); !ok || !reflect.DeepEqual(merr.Err, tt.err) {
+			t.Errorf("verifiedMarshal(%#v) error = %#v, want MarshalerError wrapping %#v", tt.v, err, tt.err)
+		}
+
+		// Marshal trusts the output.
+		if _, err := Marshal(tt.v); err != nil {
+			t.Errorf("Marshal(%#v): %v", tt.v, err)
+		}
+	}
+
+	// Elements encoded in parallel are checked as well.
+	vs := make([]interface{}, 2*minParallelElems)
+	for i := range vs {
+		vs[i] = appendTag(`"x"`)
+	}
+	vs[len(vs)-1] = appendTag(`1.0`)
+	enc := NewEncoder(ioutil.Discard)
+	enc.SetParallelism(4)
+	enc.SetVerifyMarshalers(true)
+	if err := enc.Encode(vs); err == nil {
+		t.Error("parallel Encode: expected error")
+	} else if _, ok := err.(*MarshalerError); !ok {
+		t.Errorf("parallel Encode: got error %#v, want MarshalerError", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Equal reports whether the JSON documents a and b are semantically
+// equal, i.e. whether they have identical canonical forms.
+// In particular, numbers are compared by their normalized text rather
+// than by conversion to float64.
+func Equal(a, b []byte) (bool, error) {
+	av, err := unmarshalGeneric(a)
+	if err != nil {
+		return false, err
+	}
+	bv, err := unmarshalGeneric(b)
+	if err != nil {
+		return false, err
+	}
+	return sameValue(av, bv)
+}
+
+// A Difference describes a single location at which two JSON documents
+// differ.
+type Difference struct {
+	Path string     // JSON Pointer (RFC 6901) to the differing value
+	Old  RawMessage // canonical encoding of the old value, or nil if absent
+	New  RawMessage // canonical encoding of the new value, or nil if absent
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = `""`
+	}
+	switch {
+	case d.Old == nil:
+		return path + ": added " + string(d.New)
+	case d.New == nil:
+		return path + ": removed " + string(d.Old)
+	}
+	return path + ": " + string(d.Old) + " => " + string(d.New)
+}
+
+// Diff compares the JSON documents a and b and returns the differences
+// between them in canonical order, or nil if they are semantically equal.
+// Objects are compared member by member and arrays element by element,
+// so each Difference identifies the deepest value that differs.
+func Diff(a, b []byte) ([]Difference, error) {
+	av, err := unmarshalGeneric(a)
+	if err != nil {
+		return nil, err
+	}
+	bv, err := unmarshalGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []Difference
+	err = diffValues(&diffs, "", av, bv)
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// diffValues appends to diffs the differences between decoded values a
+// and b, which are both found at the JSON Pointer path.
+func diffValues(diffs *[]Difference, path string, a, b interface{}) error {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := diffMember(diffs, path+"/"+escapePointerToken(k), av, bv, k); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			elemPath := path + "/" + strconv.Itoa(i)
+			var err error
+			switch {
+			case i >= len(bv):
+				err = appendDifference(diffs, elemPath, av[i], nil, true, false)
+			case i >= len(av):
+				err = appendDifference(diffs, elemPath, nil, bv[i], false, true)
+			default:
+				err = diffValues(diffs, elemPath, av[i], bv[i])
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return appendDifference(diffs, path, a, b, true, true)
+}
+
+// diffMember is diffValues for the member k of objects a and b.
+func diffMember(diffs *[]Difference, path string, a, b map[string]interface{}, k string) error {
+	av, aok := a[k]
+	bv, bok := b[k]
+	if aok && bok {
+		return diffValues(diffs, path, av, bv)
+	}
+	return appendDifference(diffs, path, av, bv, aok, bok)
+}
+
+// appendDifference appends a Difference for path to diffs if the present
+// values among a and b do not have identical canonical encodings.
+func appendDifference(diffs *[]Difference, path string, a, b interface{}, aok, bok bool) error {
+	d := Difference{Path: path}
+	if aok {
+		enc, err := Marshal(a)
+		if err != nil {
+			return err
+		}
+		d.Old = enc
+	}
+	if bok {
+		enc, err := Marshal(b)
+		if err != nil {
+			return err
+		}
+		d.New = enc
+	}
+	if aok && bok && string(d.Old) == string(d.New) {
+		return nil
+	}
+	*diffs = append(*diffs, d)
+	return nil
+}
+
+var pointerTokenEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapePointerToken escapes an object key for use as a JSON Pointer
+// reference token.
+func escapePointerToken(s string) string {
+	return pointerTokenEscaper.Replace(s)
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"reflect"
+	"testing"
+)
+
+var equalTests = []struct {
+	a, b  string
+	equal bool
+}{
+	{`1`, `1.0`, true},
+	{`1`, `1E0`, true},
+	{`100`, `1e2`, true},
+	{`0.1`, `1.0E-1`, true},
+	{`-0`, `0`, true},
+	{`9007199254740993`, `9007199254740992`, false},
+	{`"é"`, `"é"`, true},
+	{`"a"`, `"b"`, false},
+	{`{"a":1,"b":[true,null]}`, "{ \"b\" : [ true , null ], \"a\" : 1.0 }", true},
+	{`{"a":1}`, `{"a":1,"b":2}`, false},
+	{`[1,2]`, `[2,1]`, false},
+	{`null`, `{}`, false},
+}
+
+func TestEqual(t *testing.T) {
+	for i, tt := range equalTests {
+		got, err := Equal([]byte(tt.a), []byte(tt.b))
+		if err != nil {
+			t.Errorf("#%d: Equal(%s, %s): %v", i, tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.equal {
+			t.Errorf("#%d: Equal(%s, %s) = %v, want %v", i, tt.a, tt.b, got, tt.equal)
+		}
+	}
+
+	if _, err := Equal([]byte(`[`), []byte(`[]`)); err == nil {
+		t.Error("Equal with invalid input: expected error")
+	}
+}
+
+var diffTests = []struct {
+	a, b  string
+	diffs []Difference
+}{
+	{`{"a":1}`, `{"a":1.0}`, nil},
+	{`1`, `2`, []Difference{{"", RawMessage(`1`), RawMessage(`2`)}}},
+	{`{"a":1,"b":{"c":"x","d":[1,2]}}`, `{"a":1,"b":{"c":"y","d":[1,2,3]},"e/f~":null}`, []Difference{
+		{"/b/c", RawMessage(`"x"`), RawMessage(`"y"`)},
+		{"/b/d/2", nil, RawMessage(`3`)},
+		{"/e~1f~0", nil, RawMessage(`null`)},
+	}},
+	{`{"a":[1,{"b":0.5}],"z":true}`, `{"a":[1]}`, []Difference{
+		{"/a/1", RawMessage(`{"b":5.0E-1}`), nil},
+		{"/z", RawMessage(`true`), nil},
+	}},
+	{`{"a":{}}`, `{"a":[]}`, []Difference{{"/a", RawMessage(`{}`), RawMessage(`[]`)}}},
+}
+
+func TestDiff(t *testing.T) {
+	for i, tt := range diffTests {
+		got, err := Diff([]byte(tt.a), []byte(tt.b))
+		if err != nil {
+			t.Errorf("#%d: Diff(%s, %s): %v", i, tt.a, tt.b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.diffs) {
+			t.Errorf("#%d: Diff(%s, %s):\n got: %v\nwant: %v", i, tt.a, tt.b, got, tt.diffs)
+		}
+	}
+}
+
+func TestDifferenceString(t *testing.T) {
+	for _, tt := range []struct {
+		d    Difference
+		want string
+	}{
+		{Difference{"", RawMessage(`1`), RawMessage(`2`)}, `"": 1 => 2`},
+		{Difference{"/a/0", nil, RawMessage(`"x"`)}, `/a/0: added "x"`},
+		{Difference{"/b", RawMessage(`{}`), nil}, `/b: removed {}`},
+	} {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package canonicaljson
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+)
+
+// largeExponent matches exponents too large to fuzz efficiently, since
+// integral numbers are written out in full (e.g., 1E99999 as 100000 bytes).
+var largeExponent = regexp.MustCompile(`[Ee][+-]?0*[0-9]{5}`)
+
+// FuzzCanonicalize checks that canonicalization of arbitrary input is
+// idempotent, produces valid JSON, and preserves the decoded value.
+func FuzzCanonicalize(f *testing.F) {
+	for _, tt := range unmarshalTests {
+		f.Add([]byte(tt.in))
+	}
+	for _, tt := range encodeStringTests {
+		f.Add([]byte(tt.out))
+	}
+	f.Add([]byte(optionalsExpected))
+	f.Add([]byte(namedExpected))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if largeExponent.Match(data) {
+			return
+		}
+		canonical, err := canonicalizeUnmarshal(data)
+		if err != nil {
+			return
+		}
+		if err := checkValid(canonical, &scanner{}); err != nil {
+			t.Fatalf("canonical output %q of %q is invalid: %v", canonical, data, err)
+		}
+		again, err := canonicalizeUnmarshal(canonical)
+		if err != nil {
+			t.Fatalf("canonicalizing %q: %v", canonical, err)
+		}
+		if !bytes.Equal(again, canonical) {
+			t.Fatalf("not idempotent: %q => %q => %q", data, canonical, again)
+		}
+
+		// Decoding with float64 numbers is unaffected by canonicalization,
+		// including failure on out-of-range numbers.
+		var v1, v2 interface{}
+		err1 := Unmarshal(data, &v1)
+		err2 := Unmarshal(canonical, &v2)
+		if (err1 == nil) != (err2 == nil) {
+			t.Fatalf("decoding %q: %v; decoding canonical %q: %v", data, err1, canonical, err2)
+		}
+		if err1 == nil && !reflect.DeepEqual(v1, v2) {
+			t.Fatalf("%q decodes to %#v; canonical %q decodes to %#v", data, v1, canonical, v2)
+		}
+	})
+}
+
+// FuzzString checks that strings encode to valid JSON that decodes back
+// to the same string.
+func FuzzString(f *testing.F) {
+	for _, tt := range encodeStringTests {
+		f.Add(tt.in)
+	}
+	for _, tt := range unmarshalTests {
+		if s, ok := tt.out.(string); ok {
+			f.Add(s)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		b, err := Marshal(s)
+		if err != nil {
+			if utf8.ValidString(s) {
+				t.Fatalf("Marshal(%q): %v", s, err)
+			}
+			return
+		}
+		if err := checkValid(b, &scanner{}); err != nil {
+			t.Fatalf("Marshal(%q) = %q is invalid: %v", s, b, err)
+		}
+		var back string
+		if err := Unmarshal(b, &back); err != nil {
+			t.Fatalf("Unmarshal(%q): %v", b, err)
+		}
+		if utf8.ValidString(s) && back != s {
+			t.Fatalf("Marshal(%q) = %q decodes to %q", s, b, back)
+		}
+		if again, err := Marshal(back); err != nil || !bytes.Equal(again, b) {
+			t.Fatalf("Marshal(%q) = %q, want %q (%v)", back, again, b, err)
+		}
+	})
+}
+
+// FuzzNumber checks that number text normalizes identically as Number and
+// json.Number, and that normalization is idempotent.
+func FuzzNumber(f *testing.F) {
+	for _, tt := range numberTests {
+		f.Add(tt.in)
+	}
+	for expected, inputs := range floats {
+		f.Add(expected)
+		for _, input := range inputs {
+			f.Add(input)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if largeExponent.MatchString(s) {
+			return
+		}
+		if !isValidNumber(s) {
+			if _, err := Marshal(Number(s)); err == nil {
+				t.Fatalf("Marshal(Number(%q)): expected error", s)
+			}
+			return
+		}
+		b, err := Marshal(Number(s))
+		if err != nil {
+			t.Fatalf("Marshal(Number(%q)): %v", s, err)
+		}
+		if !isValidNumber(string(b)) {
+			t.Fatalf("Marshal(Number(%q)) = %q is not a number", s, b)
+		}
+		if jb, err := Marshal(json.Number(s)); err != nil || !bytes.Equal(jb, b) {
+			t.Fatalf("Marshal(json.Number(%q)) = %q, want %q (%v)", s, jb, b, err)
+		}
+		if again, err := Marshal(Number(b)); err != nil || !bytes.Equal(again, b) {
+			t.Fatalf("Marshal(Number(%q)) = %q, want %q (%v)", b, again, b, err)
+		}
+
+		// Normalization preserves value.
+		x, err1 := strconv.ParseFloat(s, 64)
+		y, err2 := strconv.ParseFloat(string(b), 64)
+		if (err1 == nil) != (err2 == nil) || x != y {
+			t.Fatalf("Number(%q) = %g (%v) normalizes to %q = %g (%v)", s, x, err1, b, y, err2)
+		}
+	})
+}
+
+// FuzzFloat checks that float64 values normalize identically to their
+// shortest decimal representation as Number and json.Number.
+func FuzzFloat(f *testing.F) {
+	for _, inputs := range floats {
+		for _, input := range inputs {
+			x, _ := strconv.ParseFloat(input, 64)
+			f.Add(x)
+		}
+	}
+	for _, tt := range numberTests {
+		f.Add(tt.f)
+	}
+	f.Add(math.MaxFloat64)
+	f.Add(math.SmallestNonzeroFloat64)
+	f.Add(math.Copysign(0, -1))
+
+	f.Fuzz(func(t *testing.T, x float64) {
+		b, err := Marshal(x)
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			if err == nil {
+				t.Fatalf("Marshal(%g) = %q, want error", x, b)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Marshal(%g): %v", x, err)
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if nb, err := Marshal(Number(s)); err != nil || !bytes.Equal(nb, b) {
+			t.Fatalf("Marshal(Number(%q)) = %q, want %q (%v)", s, nb, b, err)
+		}
+		if jb, err := Marshal(json.Number(s)); err != nil || !bytes.Equal(jb, b) {
+			t.Fatalf("Marshal(json.Number(%q)) = %q, want %q (%v)", s, jb, b, err)
+		}
+		if y, err := strconv.ParseFloat(string(b), 64); err != nil || y != x {
+			t.Fatalf("Marshal(%g) = %q parses as %g (%v)", x, b, y, err)
+		}
+	})
+}
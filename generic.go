@@ -0,0 +1,28 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package canonicaljson
+
+// UnmarshalAs parses the JSON-encoded data and returns the result as a T.
+//
+// See the documentation for Unmarshal for details about
+// the conversion of JSON into a Go value.
+func UnmarshalAs[T any](data []byte) (T, error) {
+	var v T
+	err := Unmarshal(data, &v)
+	return v, err
+}
+
+// DecodeAs reads the next JSON-encoded value from dec
+// and returns it as a T.
+//
+// See the documentation for Decoder.Decode for details.
+func DecodeAs[T any](dec *Decoder) (T, error) {
+	var v T
+	err := dec.Decode(&v)
+	return v, err
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package canonicaljson
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalAs(t *testing.T) {
+	p, err := UnmarshalAs[Point]([]byte(`{"Z": 1}`))
+	if err != nil || p != (Point{Z: 1}) {
+		t.Errorf("UnmarshalAs[Point] = %#v, %v", p, err)
+	}
+
+	m, err := UnmarshalAs[map[string][]int]([]byte(`{"a": [1, 2]}`))
+	if want := map[string][]int{"a": {1, 2}}; err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("UnmarshalAs[map[string][]int] = %#v, %v; want %#v", m, err, want)
+	}
+
+	if _, err := UnmarshalAs[int]([]byte(`"1"`)); err == nil {
+		t.Error("UnmarshalAs[int](string): expected error")
+	} else if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Errorf("UnmarshalAs[int](string): got error %T, want *UnmarshalTypeError", err)
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`"a" 2.5 ["b"]`))
+	if s, err := DecodeAs[string](dec); err != nil || s != "a" {
+		t.Errorf("DecodeAs[string] = %q, %v", s, err)
+	}
+	if n, err := DecodeAs[Number](dec); err != nil || n != "2.5" {
+		t.Errorf("DecodeAs[Number] = %q, %v", n, err)
+	}
+	if a, err := DecodeAs[[1]string](dec); err != nil || a != [1]string{"b"} {
+		t.Errorf("DecodeAs[[1]string] = %q, %v", a, err)
+	}
+	if _, err := DecodeAs[interface{}](dec); err != io.EOF {
+		t.Errorf("DecodeAs at end of input: got %v, want io.EOF", err)
+	}
+}
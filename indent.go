@@ -32,7 +32,16 @@ func addIndentation(dst *bytes.Buffer, src []byte, prefix, indent string) error
 	scan.reset()
 	needIndent := false
 	depth := 0
-	for _, c := range src {
+	for i := 0; i < len(src); i++ {
+		if scan.run != runNone {
+			n := scan.continueRun(src[i:])
+			scan.bytes += int64(n)
+			dst.Write(src[i : i+n])
+			if i += n; i == len(src) {
+				break
+			}
+		}
+		c := src[i]
 		scan.bytes++
 		v := scan.step(&scan, c)
 		if v == scanSkipSpace {
@@ -0,0 +1,458 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fields resolves the struct fields recognized by canonicaljson
+// and its sibling encodings, so that every representation of a Go value
+// describes the same logical document.
+package fields
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// A Field represents a single field found in a struct.
+type Field struct {
+	Name      string
+	NameBytes []byte                 // []byte(Name)
+	EqualFold func(s, t []byte) bool // bytes.EqualFold or equivalent
+
+	Tag       bool // whether Name came from a json tag
+	Index     []int
+	Type      reflect.Type
+	OmitEmpty bool
+	OmitZero  bool
+	Quoted    bool
+
+	// Set reports whether the field is a slice or array whose elements
+	// are sorted by their encodings, and Unique whether duplicate elements
+	// are rejected as well.
+	Set    bool
+	Unique bool
+
+	// Inline reports whether the field is a map with string keys whose
+	// entries stand in for members of the enclosing object. An inline
+	// field has an empty Name, so it sorts before every other field.
+	Inline bool
+
+	// IsZero reports whether a value of the field is zero, using its
+	// IsZero method if it has one. It is set only when OmitZero is.
+	IsZero func(v reflect.Value) bool
+}
+
+func fillField(f Field) Field {
+	f.NameBytes = []byte(f.Name)
+	f.EqualFold = foldFunc(f.NameBytes)
+	return f
+}
+
+// byName sorts field by name, breaking ties with depth,
+// then breaking ties with "name came from json tag", then
+// breaking ties with index sequence.
+type byName []Field
+
+func (x byName) Len() int { return len(x) }
+
+func (x byName) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+func (x byName) Less(i, j int) bool {
+	if x[i].Name != x[j].Name {
+		return x[i].Name < x[j].Name
+	}
+	if len(x[i].Index) != len(x[j].Index) {
+		return len(x[i].Index) < len(x[j].Index)
+	}
+	if x[i].Tag != x[j].Tag {
+		return x[i].Tag
+	}
+	return byIndex(x).Less(i, j)
+}
+
+// byIndex sorts field by index sequence.
+type byIndex []Field
+
+func (x byIndex) Len() int { return len(x) }
+
+func (x byIndex) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+func (x byIndex) Less(i, j int) bool {
+	for k, xik := range x[i].Index {
+		if k >= len(x[j].Index) {
+			return false
+		}
+		if xik != x[j].Index[k] {
+			return xik < x[j].Index[k]
+		}
+	}
+	return len(x[i].Index) < len(x[j].Index)
+}
+
+// typeFields returns a list of fields that JSON should recognize for the given type.
+// The algorithm is breadth-first search over the set of structs to include - the top struct
+// and then any reachable anonymous structs.
+func typeFields(t reflect.Type) []Field {
+	// Anonymous fields to explore at the current level and the next.
+	current := []Field{}
+	next := []Field{{Type: t}}
+
+	// Count of queued names for current level and the next.
+	count := map[reflect.Type]int{}
+	nextCount := map[reflect.Type]int{}
+
+	// Types already visited at an earlier level.
+	visited := map[reflect.Type]bool{}
+
+	// Fields found.
+	var fields []Field
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, f := range current {
+			if visited[f.Type] {
+				continue
+			}
+			visited[f.Type] = true
+
+			// Scan f.Type for fields to include.
+			for i := 0; i < f.Type.NumField(); i++ {
+				sf := f.Type.Field(i)
+				if sf.PkgPath != "" && !sf.Anonymous { // unexported
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := ParseTag(tag)
+				if !IsValidTag(name) {
+					name = ""
+				}
+				index := make([]int, len(f.Index)+1)
+				copy(index, f.Index)
+				index[len(f.Index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					// Follow pointer.
+					ft = ft.Elem()
+				}
+
+				// Only strings, floats, integers, and booleans can be quoted.
+				quoted := false
+				if opts.Contains("string") {
+					switch ft.Kind() {
+					case reflect.Bool,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+						reflect.Float32, reflect.Float64,
+						reflect.String:
+						quoted = true
+					}
+				}
+
+				// Only slices and arrays (but not byte slices, which encode as
+				// strings) can be sets.
+				set := false
+				if opts.Contains("set") {
+					switch sf.Type.Kind() {
+					case reflect.Slice:
+						set = sf.Type.Elem().Kind() != reflect.Uint8
+					case reflect.Array:
+						set = true
+					}
+				}
+
+				// Record a map field with the ",inline" option under an
+				// empty name, which no other field can have.
+				if opts.Contains("inline") && sf.Type.Kind() == reflect.Map && sf.Type.Key().Kind() == reflect.String {
+					fields = append(fields, fillField(Field{
+						Index:  index,
+						Type:   sf.Type,
+						Inline: true,
+					}))
+					if count[f.Type] > 1 {
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+
+				// Record found field and index sequence.
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name
+					}
+					fields = append(fields, fillField(Field{
+						Name:      name,
+						Tag:       tagged,
+						Index:     index,
+						Type:      ft,
+						OmitEmpty: opts.Contains("omitempty"),
+						OmitZero:  opts.Contains("omitzero"),
+						Quoted:    quoted,
+						Set:       set,
+						Unique:    set && opts.Contains("unique"),
+					}))
+					if opts.Contains("omitzero") {
+						fields[len(fields)-1].IsZero = isZeroFunc(sf.Type)
+					}
+					if count[f.Type] > 1 {
+						// If there were multiple instances, add a second,
+						// so that the annihilation code will see a duplicate.
+						// It only cares about the distinction between 1 or 2,
+						// so don't bother generating any more copies.
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+
+				// Record new anonymous struct to explore in next round.
+				nextCount[ft]++
+				if nextCount[ft] == 1 {
+					next = append(next, fillField(Field{Name: ft.Name(), Index: index, Type: ft}))
+				}
+			}
+		}
+	}
+
+	sort.Sort(byName(fields))
+
+	// Delete all fields that are hidden by the Go rules for embedded fields,
+	// except that fields with JSON tags are promoted.
+
+	// The fields are sorted in primary order of name, secondary order
+	// of field index length. Loop over names; for each name, delete
+	// hidden fields by choosing the one dominant field that survives.
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		// One iteration per name.
+		// Find the sequence of fields with the name of this first field.
+		fi := fields[i]
+		name := fi.Name
+		for advance = 1; i+advance < len(fields); advance++ {
+			fj := fields[i+advance]
+			if fj.Name != name {
+				break
+			}
+		}
+		if advance == 1 { // Only one field with this name
+			out = append(out, fi)
+			continue
+		}
+		dominant, ok := dominantField(fields[i : i+advance])
+		if ok {
+			out = append(out, dominant)
+		}
+	}
+
+	return out
+}
+
+// dominantField looks through the fields, all of which are known to
+// have the same name, to find the single field that dominates the
+// others using Go's embedding rules, modified by the presence of
+// JSON tags. If there are multiple top-level fields, the boolean
+// will be false: This condition is an error in Go and we skip all
+// the fields.
+func dominantField(fields []Field) (Field, bool) {
+	// The fields are sorted in increasing index-length order. The winner
+	// must therefore be one with the shortest index length. Drop all
+	// longer entries, which is easy: just truncate the slice.
+	length := len(fields[0].Index)
+	tagged := -1 // Index of first tagged field.
+	for i, f := range fields {
+		if len(f.Index) > length {
+			fields = fields[:i]
+			break
+		}
+		if f.Tag {
+			if tagged >= 0 {
+				// Multiple tagged fields at the same level: conflict.
+				// Return no field.
+				return Field{}, false
+			}
+			tagged = i
+		}
+	}
+	if tagged >= 0 {
+		return fields[tagged], true
+	}
+	// All remaining fields have the same length. If there's more than one,
+	// we have a conflict (two fields named "X" at the same level) and we
+	// return no field.
+	if len(fields) > 1 {
+		return Field{}, false
+	}
+	return fields[0], true
+}
+
+// fieldCache maps struct types to their fields. Reads are lock-free;
+// writers copy the map under mu and store the copy.
+var fieldCache struct {
+	value atomic.Value // map[reflect.Type][]Field
+	mu    sync.Mutex   // used only by writers
+}
+
+// CachedTypeFields returns the fields that JSON should recognize for the
+// given struct type, sorted by name. It is like typeFields but uses a
+// cache to avoid repeated work.
+func CachedTypeFields(t reflect.Type) []Field {
+	m, _ := fieldCache.value.Load().(map[reflect.Type][]Field)
+	f := m[t]
+	if f != nil {
+		return f
+	}
+
+	// Compute fields without lock.
+	// Might duplicate effort but won't hold other computations back.
+	f = typeFields(t)
+	if f == nil {
+		f = []Field{}
+	}
+
+	fieldCache.mu.Lock()
+	m, _ = fieldCache.value.Load().(map[reflect.Type][]Field)
+	newM := make(map[reflect.Type][]Field, len(m)+1)
+	for k, v := range m {
+		newM[k] = v
+	}
+	newM[t] = f
+	fieldCache.value.Store(newM)
+	fieldCache.mu.Unlock()
+	return f
+}
+
+// Inline returns the ",inline" field of fs, or nil if there is none.
+func Inline(fs []Field) *Field {
+	if len(fs) > 0 && fs[0].Inline {
+		return &fs[0]
+	}
+	return nil
+}
+
+// Lookup returns the field of fs that an object member named key decodes
+// into, preferring an exact match to a case-insensitive one, or nil if
+// there is none. The ",inline" field is never returned.
+func Lookup(fs []Field, key []byte) *Field {
+	var f *Field
+	for i := range fs {
+		ff := &fs[i]
+		if ff.Inline {
+			continue
+		}
+		if bytes.Equal(ff.NameBytes, key) {
+			return ff
+		}
+		if f == nil && ff.EqualFold(ff.NameBytes, key) {
+			f = ff
+		}
+	}
+	return f
+}
+
+// LookupExact returns the field of fs named exactly key, or nil if there is
+// none. The ",inline" field is never returned.
+func LookupExact(fs []Field, key []byte) *Field {
+	for i := range fs {
+		if ff := &fs[i]; !ff.Inline && bytes.Equal(ff.NameBytes, key) {
+			return ff
+		}
+	}
+	return nil
+}
+
+// IsValidTag reports whether s may be used as a JSON object key in a
+// struct field's tag.
+func IsValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but
+			// otherwise any punctuation chars are allowed
+			// in a tag name.
+		default:
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// isZeroFunc returns a function reporting whether a value of type t is
+// zero, according to its IsZero method if it has one and otherwise
+// according to reflect.Value.IsZero.
+func isZeroFunc(t reflect.Type) func(reflect.Value) bool {
+	switch {
+	case t.Kind() == reflect.Interface && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			// Avoid calling IsZero on a nil interface or a nil pointer.
+			return v.IsNil() ||
+				v.Elem().Kind() == reflect.Ptr && v.Elem().IsNil() ||
+				v.Interface().(isZeroer).IsZero()
+		}
+	case t.Kind() == reflect.Ptr && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.IsNil() || v.Interface().(isZeroer).IsZero()
+		}
+	case t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.Interface().(isZeroer).IsZero()
+		}
+	case reflect.PtrTo(t).Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			if !v.CanAddr() {
+				// Copy v so that its address can be taken.
+				v2 := reflect.New(v.Type()).Elem()
+				v2.Set(v)
+				v = v2
+			}
+			return v.Addr().Interface().(isZeroer).IsZero()
+		}
+	}
+	return reflect.Value.IsZero
+}
+
+// FieldByIndex returns the nested field of struct v at index, following
+// pointers to embedded structs, or the zero Value if such a pointer is nil.
+func FieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// TypeByIndex returns the type of the nested field of struct type t at index.
+func TypeByIndex(t reflect.Type, index []int) reflect.Type {
+	for _, i := range index {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.Field(i).Type
+	}
+	return t
+}
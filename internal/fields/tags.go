@@ -3,29 +3,29 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package canonicaljson
+package fields
 
 import (
 	"strings"
 )
 
-// tagOptions is the string following a comma in a struct field's "json"
+// TagOptions is the string following a comma in a struct field's "json"
 // tag, or the empty string. It does not include the leading comma.
-type tagOptions string
+type TagOptions string
 
-// parseTag splits a struct field's json tag into its name and
+// ParseTag splits a struct field's json tag into its name and
 // comma-separated options.
-func parseTag(tag string) (string, tagOptions) {
+func ParseTag(tag string) (string, TagOptions) {
 	if idx := strings.Index(tag, ","); idx != -1 {
-		return tag[:idx], tagOptions(tag[idx+1:])
+		return tag[:idx], TagOptions(tag[idx+1:])
 	}
-	return tag, tagOptions("")
+	return tag, TagOptions("")
 }
 
 // Contains reports whether a comma-separated list of options
 // contains a particular substr flag. substr must be surrounded by a
 // string boundary or commas.
-func (o tagOptions) Contains(optionName string) bool {
+func (o TagOptions) Contains(optionName string) bool {
 	if len(o) == 0 {
 		return false
 	}
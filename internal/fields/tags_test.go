@@ -3,14 +3,14 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package canonicaljson
+package fields
 
 import (
 	"testing"
 )
 
 func TestTagParsing(t *testing.T) {
-	name, opts := parseTag("field,foobar,foo")
+	name, opts := ParseTag("field,foobar,foo")
 	if name != "field" {
 		t.Fatalf("name = %q, want field", name)
 	}
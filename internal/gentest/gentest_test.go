@@ -0,0 +1,410 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gentest
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+// Types without the generated methods, for the reflective encoder and
+// decoder.
+type (
+	plainScalars   Scalars
+	plainComposite Composite
+	plainEmbedding Embedding
+	plainAddressed Addressed
+	plainZeros     Zeros
+	plainEmpty     Empty
+)
+
+func sampleScalars() Scalars {
+	n := -7
+	return Scalars{
+		Bool:    true,
+		Int:     -1,
+		Int8:    -128,
+		Uint16:  65535,
+		Uintptr: 1,
+		F32:     0.1,
+		F64:     -1e21,
+		Temp:    -40,
+		Str:     " <&>\"\\\x01é",
+		Name:    "name",
+		Flag:    true,
+		Num:     "1.50",
+		JSONNum: "-0.0e-0",
+		Ünïcode: "ü",
+		Tagged:  "t",
+		Invalid: "i",
+		Ignored: 1,
+		Dash:    2,
+		private: 3,
+		QBool:   true,
+		QInt:    math.MinInt64,
+		QUint:   255,
+		QFloat:  1e-7,
+		QStr:    "q\"",
+		QPtr:    &n,
+		QNum:    "10",
+	}
+}
+
+func sampleComposite() Composite {
+	f := 2.5
+	s := "s"
+	ps := &s
+	return Composite{
+		Ptr:       &Scalars{Int: 1, Num: "1", QNum: "1"},
+		Value:     sampleScalars(),
+		Slice:     []Scalars{{Num: "0", QNum: "0"}, {Str: "x", Num: "2", QNum: "2"}},
+		Array:     [2]*float64{&f, nil},
+		Full:      [1]int{0},
+		Ints:      []int{3, 2, 1},
+		Nested:    [][]string{{"a", "b"}, nil, {}},
+		Bytes:     []byte{0, 1, 2, 255},
+		Map:       map[string]int{"b": 2, "a": 1, "é": 0},
+		Interface: []interface{}{1.0, "x", nil, Scalars{Num: "3", QNum: "3"}},
+		Stringer:  time.Second,
+		Time:      time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC),
+		TimePtr:   &time.Time{},
+		Raw:       canonicaljson.RawMessage(`{"b": 1.0, "a": [ ]}`),
+		Struct:    struct{ A, B int }{1, 2},
+		PtrPtr:    &ps,
+	}
+}
+
+func sampleAddressed() Addressed {
+	c := Caps("ptr")
+	return Addressed{
+		Hex:   255,
+		Caps:  "caps",
+		Caps2: []Caps{"a", "B"},
+		Ptr:   &c,
+		Inner: &Addressed{Caps: "inner", Inner: &Addressed{}},
+	}
+}
+
+// pair holds a value of a generated type and the same value of its plain
+// counterpart, both addressable.
+type pair struct {
+	name       string
+	gen, plain interface{}
+}
+
+func encodePairs() []pair {
+	var ps []pair
+	add := func(name string, gen, plain interface{}) {
+		ps = append(ps, pair{name, gen, plain})
+	}
+
+	for _, s := range []Scalars{{}, sampleScalars()} {
+		s := s
+		add("Scalars", &s, (*plainScalars)(&s))
+	}
+	nan := sampleScalars()
+	nan.F32 = float32(math.NaN())
+	add("Scalars/NaN", &nan, (*plainScalars)(&nan))
+	inf := sampleScalars()
+	inf.QFloat = math.Inf(-1)
+	add("Scalars/Inf", &inf, (*plainScalars)(&inf))
+	invalid := sampleScalars()
+	invalid.QStr = "\xff"
+	add("Scalars/InvalidUTF8", &invalid, (*plainScalars)(&invalid))
+	badNum := sampleScalars()
+	badNum.Num = "0x1"
+	add("Scalars/BadNumber", &badNum, (*plainScalars)(&badNum))
+
+	for _, c := range []Composite{{}, sampleComposite()} {
+		c := c
+		add("Composite", &c, (*plainComposite)(&c))
+	}
+
+	for _, e := range []Embedding{
+		{},
+		{Inner: Inner{1, "b"}, inner: &inner{2, 3}, Other: &Other{4, 5, 6}, Tagged: Tagged{7}, Own: 8},
+	} {
+		e := e
+		add("Embedding", &e, (*plainEmbedding)(&e))
+	}
+
+	for _, a := range []Addressed{{}, sampleAddressed()} {
+		a := a
+		add("Addressed", &a, (*plainAddressed)(&a))
+	}
+
+	negZero := math.Copysign(0, -1)
+	zero, one := 0, 1
+	emptyTime := time.Time{}
+	for _, z := range []Zeros{
+		{},
+		{
+			Float:   negZero,
+			Slice:   []int{},
+			Map:     map[string]int{},
+			Ptr:     &zero,
+			Array:   [2]float64{0, negZero},
+			Time:    time.Time{}.Local(),
+			TimePtr: &emptyTime,
+			PtrZero: PtrZero{-1},
+			Iface:   0,
+			Zeroer:  (*PtrZero)(nil),
+			Mixed:   struct{ I interface{} }{[]int{}},
+			Both:    []int{},
+		},
+		{
+			Int:     1,
+			Float:   0.5,
+			Str:     "s",
+			Slice:   []int{0},
+			Map:     map[string]int{"": 0},
+			Ptr:     &one,
+			Array:   [2]float64{0, 1},
+			Struct:  Inner{B: "b"},
+			Time:    time.Unix(0, 0).UTC(),
+			TimePtr: &time.Time{},
+			PtrZero: PtrZero{1},
+			Iface:   []int(nil),
+			Zeroer:  &PtrZero{1},
+			Mixed:   struct{ I interface{} }{0},
+			Both:    []int{1},
+		},
+	} {
+		z := z
+		add("Zeros", &z, (*plainZeros)(&z))
+	}
+
+	add("Empty", &Empty{1}, &plainEmpty{1})
+	return ps
+}
+
+// marshalString returns the encoding of v as a string, and whether
+// encoding failed. Error messages are not compared, since they may name
+// different types. The output of generated methods must be canonical.
+func marshalString(v interface{}) (string, bool) {
+	var buf bytes.Buffer
+	enc := canonicaljson.NewEncoder(&buf)
+	enc.SetVerifyMarshalers(true)
+	err := enc.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n"), err != nil
+}
+
+func TestAppendCanonicalJSON(t *testing.T) {
+	for _, p := range encodePairs() {
+		want, wantErr := marshalString(p.plain)
+
+		// Addressable.
+		if got, gotErr := marshalString(p.gen); got != want || gotErr != wantErr {
+			t.Errorf("%s: Marshal(%#v) = %#q, error %v; want %#q, error %v", p.name, p.gen, got, gotErr, want, wantErr)
+		}
+
+		// Not addressable.
+		plain := reflect.ValueOf(p.plain).Elem().Interface()
+		gen := reflect.ValueOf(p.gen).Elem().Interface()
+		want2, wantErr2 := marshalString(plain)
+		if got, gotErr := marshalString(gen); got != want2 || gotErr != wantErr2 {
+			t.Errorf("%s: Marshal(%#v) = %#q, error %v; want %#q, error %v", p.name, gen, got, gotErr, want2, wantErr2)
+		}
+
+		// The generated method is used directly.
+		m, ok := p.gen.(canonicaljson.AppendMarshaler)
+		if !ok {
+			t.Errorf("%s: %T is not an AppendMarshaler", p.name, p.gen)
+			continue
+		}
+		dst := []byte("prefix")
+		got, err := m.AppendCanonicalJSON(dst)
+		if wantErr {
+			if err == nil {
+				t.Errorf("%s: AppendCanonicalJSON = %#q, want error", p.name, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != "prefix"+want {
+			t.Errorf("%s: AppendCanonicalJSON = %#q, %v; want %#q", p.name, got, err, "prefix"+want)
+		}
+	}
+}
+
+var unmarshalTests = []struct {
+	inputs []string
+	gen    func() interface{}
+	plain  func() interface{}
+}{
+	{
+		inputs: []string{
+			`{}`,
+			`null`,
+			`{"Bool":true,"int":-3,"I8":7,"u16":9,"UINTPTR":2,"f32":0.5,"f64":1.5,"temp":-40,"s":"x",` +
+				`"name":"n","flag":true,"Num":1e2,"jsonNum":-0,"ÜNÏCODE":"u","z-tag/with:punct":"t",` +
+				`"Invalid":"i","Ignored":2,"-":1,"Dash":5,"private":3,"unknown":[1,{"a":null}],` +
+				`"QBool":"false","QInt":"-5","QUint":"7","QFloat":"2.5","QStr":"\"q\"","QPtr":"4",` +
+				`"QNum":"10","qnum":"1.0"}`,
+			`{"Int":1,"int":2,"INT":3}`,
+			`{"QPtr":"null","QStr":"null"}`,
+			`{"Int":"1","Str":2,"Bool":true}`,
+			`{"QInt":5,"Bool":true}`,
+			`{"QInt":"x"}`,
+			`{"Int":1.5}`,
+			`{"Int8":128}`,
+			`{"Int":1`,
+			`[]`,
+			`"string"`,
+			`1`,
+			`true`,
+		},
+		gen:   func() interface{} { v := sampleScalars(); return &v },
+		plain: func() interface{} { v := plainScalars(sampleScalars()); return &v },
+	},
+	{
+		inputs: []string{
+			`{}`,
+			`{"Ptr":{"Int":1},"value":{"s":"v"},"Slice":[{},{"Bool":true}],"Array":[1,null,3],` +
+				`"Empty":[1],"Nested":[["a"],null],"Bytes":"AQI=","Map":{"a":1},"Interface":[1,"x"],` +
+				`"Time":"2016-01-02T03:04:05Z","TimePtr":null,"Raw":{"b":1, "a":2},` +
+				`"Struct":{"A":1},"PtrPtr":"p"}`,
+			`{"Ptr":null,"Slice":null,"Map":null,"Interface":null,"PtrPtr":null}`,
+			`{"Stringer":"x"}`,
+			`{"Time":"yesterday"}`,
+		},
+		gen:   func() interface{} { v := sampleComposite(); return &v },
+		plain: func() interface{} { v := plainComposite(sampleComposite()); return &v },
+	},
+	{
+		inputs: []string{
+			`{"A":1,"b":2,"B":3,"C":4,"D":5,"E":6,"F":7,"tagged":{"F":8}}`,
+			`{"c":1}`,
+			`{"tagged":null}`,
+		},
+		gen:   func() interface{} { return new(Embedding) },
+		plain: func() interface{} { return new(plainEmbedding) },
+	},
+	{
+		inputs: []string{
+			`{"Caps":"UP","Caps2":["A","b"],"Ptr":"X","Inner":{"Caps":"Y","Inner":null},"Hex":"0x10"}`,
+			`{"Caps":1}`,
+			`{"Hex":"z"}`,
+		},
+		gen:   func() interface{} { v := sampleAddressed(); return &v },
+		plain: func() interface{} { v := plainAddressed(sampleAddressed()); return &v },
+	},
+	{
+		inputs: []string{`{}`, `{"private":1}`, `null`, `[]`},
+		gen:    func() interface{} { return &Empty{1} },
+		plain:  func() interface{} { return &plainEmpty{1} },
+	},
+}
+
+type unmarshaler interface {
+	UnmarshalJSON(data []byte) error
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	for _, tt := range unmarshalTests {
+		for _, in := range tt.inputs {
+			gen, plain := tt.gen(), tt.plain()
+			err := gen.(unmarshaler).UnmarshalJSON([]byte(in))
+			wantErr := canonicaljson.Unmarshal([]byte(in), plain)
+			if (err == nil) != (wantErr == nil) {
+				t.Errorf("%T: UnmarshalJSON(%#q): %v, want %v", gen, in, err, wantErr)
+			}
+			want := reflect.ValueOf(plain).Convert(reflect.TypeOf(gen)).Interface()
+			if !reflect.DeepEqual(gen, want) {
+				t.Errorf("%T: UnmarshalJSON(%#q):\nhave %+v\nwant %+v", gen, in, gen, want)
+			}
+		}
+	}
+}
+
+// Generated types are decoded from the input as is, without first being
+// reduced to canonical form for a CanonicalUnmarshaler.
+func TestUnmarshalDirect(t *testing.T) {
+	for _, tt := range unmarshalTests {
+		v := tt.gen()
+		if _, ok := v.(canonicaljson.CanonicalUnmarshaler); ok {
+			t.Errorf("%T implements CanonicalUnmarshaler", v)
+		}
+		if _, ok := v.(canonicaljson.FieldsUnmarshaler); !ok {
+			t.Errorf("%T does not implement FieldsUnmarshaler", v)
+		}
+	}
+}
+
+// A Decoder applies its options to the fields of generated types as it
+// does to those of plain structs.
+func TestDecoderOptions(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		exact bool // match exact field names only
+	}{
+		{`{"f64":9007199254740993}`, false},
+		{`{"Bool":true,"BOOL":false,"F64":1}`, true},
+	} {
+		decode := func(v interface{}) error {
+			dec := canonicaljson.NewDecoder(strings.NewReader(tt.in))
+			dec.ExactNumbers()
+			if tt.exact {
+				dec.ExactFieldNames(true)
+			}
+			return dec.Decode(v)
+		}
+		var gen Scalars
+		var plain plainScalars
+		err, wantErr := decode(&gen), decode(&plain)
+		if wantErr == nil {
+			t.Fatalf("Decode(%#q) into %T: expected error", tt.in, &plain)
+		}
+		if err == nil || reflect.TypeOf(err) != reflect.TypeOf(wantErr) ||
+			err.Error() != strings.Replace(wantErr.Error(), "plainScalars", "Scalars", -1) {
+			t.Errorf("Decode(%#q): got error %v, want %v", tt.in, err, wantErr)
+		}
+		if !reflect.DeepEqual(gen, Scalars(plain)) {
+			t.Errorf("Decode(%#q):\nhave %+v\nwant %+v", tt.in, gen, Scalars(plain))
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	v := sampleAddressed()
+	b, err := canonicaljson.Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Addressed
+	if err := back.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	again, err := canonicaljson.Marshal(&back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, b) {
+		t.Errorf("round trip:\nhave %s\nwant %s", again, b)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	// Unmarshal calls the generated method, which must not call it back.
+	for _, in := range []string{
+		`null`, `1`, `"s"`, `true`, `[]`,
+		`{"Ptr":{"int":1},"value":{"s":"v","QPtr":"2"},"Struct":{"B":3}}`,
+	} {
+		gen, plain := sampleComposite(), plainComposite(sampleComposite())
+		err := canonicaljson.Unmarshal([]byte(in), &gen)
+		wantErr := canonicaljson.Unmarshal([]byte(in), &plain)
+		if (err == nil) != (wantErr == nil) {
+			t.Errorf("Unmarshal(%#q): %v, want %v", in, err, wantErr)
+		}
+		if !reflect.DeepEqual(gen, Composite(plain)) {
+			t.Errorf("Unmarshal(%#q):\nhave %+v\nwant %+v", in, gen, Composite(plain))
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gentest holds types with methods generated by canonicaljson-gen,
+// for comparison against the reflective encoder and decoder.
+package gentest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+//go:generate go run ../../cmd/canonicaljson-gen -type=Scalars,Composite,Embedding,Addressed,Zeros,Empty -output=types_canonicaljson.go
+
+type Celsius float32
+
+type Flag bool
+
+type Name string
+
+// Scalars has fields of every kind encoded inline.
+type Scalars struct {
+	Bool    bool
+	Int     int
+	Int8    int8    `json:"i8"`
+	Uint16  uint16  `json:"u16,omitempty"`
+	Uintptr uintptr `json:",omitempty"`
+	F32     float32
+	F64     float64 `json:"f64,omitempty"`
+	Temp    Celsius `json:"temp"`
+	Str     string  `json:"s"`
+	Name    Name    `json:"name,omitempty"`
+	Flag    Flag    `json:"flag,omitempty"`
+	Num     canonicaljson.Number
+	JSONNum json.Number `json:"jsonNum,omitempty"`
+	Ünïcode string
+	Tagged  string `json:"z-tag/with:punct"`
+	Invalid string `json:"bad\"tag"`
+	Ignored int    `json:"-"`
+	Dash    int    `json:"-,"`
+	private int
+
+	QBool  bool                 `json:",string"`
+	QInt   int64                `json:",string"`
+	QUint  uint8                `json:",string,omitempty"`
+	QFloat float64              `json:",string"`
+	QStr   string               `json:",string"`
+	QPtr   *int                 `json:",string"`
+	QNum   canonicaljson.Number `json:",string"`
+}
+
+// Composite has fields of composite kinds.
+type Composite struct {
+	Ptr       *Scalars
+	Value     Scalars `json:"value"`
+	Slice     []Scalars
+	Array     [2]*float64
+	Empty     [0]int `json:",omitempty"`
+	Full      [1]int `json:",omitempty"`
+	Ints      []int  `json:",omitempty"`
+	Nested    [][]string
+	Bytes     []byte
+	Map       map[string]int
+	Interface interface{}
+	Stringer  interface{ String() string } `json:",omitempty"`
+	Time      time.Time
+	TimePtr   *time.Time `json:",omitempty"`
+	Raw       canonicaljson.RawMessage
+	Struct    struct{ A, B int }
+	PtrPtr    **string
+}
+
+type Inner struct {
+	A int
+	B string `json:"b"`
+}
+
+type inner struct {
+	C int
+	D int
+}
+
+type Other struct {
+	A int
+	D int
+	E int `json:"C"`
+}
+
+type Tagged struct {
+	F int
+}
+
+// Embedding exercises the visibility rules for embedded fields.
+type Embedding struct {
+	Inner
+	*inner
+	*Other
+	Tagged `json:"tagged"`
+	Own    int `json:"b"`
+}
+
+// Caps marshals itself, but only through a pointer.
+type Caps string
+
+func (c *Caps) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(string(*c))), nil
+}
+
+func (c *Caps) UnmarshalText(b []byte) error {
+	*c = Caps(strings.ToLower(string(b)))
+	return nil
+}
+
+// Hex marshals itself as canonical JSON, but only through a pointer.
+type Hex uint32
+
+func (h *Hex) MarshalCanonicalJSON() ([]byte, error) {
+	return []byte(`"0x` + strconv.FormatUint(uint64(*h), 16) + `"`), nil
+}
+
+func (h *Hex) UnmarshalText(b []byte) error {
+	n, err := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, 32)
+	*h = Hex(n)
+	return err
+}
+
+// Addressed has encodings that depend on addressability.
+type Addressed struct {
+	Hex   Hex `json:",omitempty"`
+	Caps  Caps
+	Caps2 []Caps
+	Ptr   *Caps
+	Inner *Addressed `json:",omitempty"`
+}
+
+// PtrZero is zero when N is not positive, but only through a pointer.
+type PtrZero struct {
+	N int
+}
+
+func (p *PtrZero) IsZero() bool {
+	return p.N <= 0
+}
+
+// Zeros has fields with the "omitzero" option.
+type Zeros struct {
+	Int     int                        `json:",omitzero"`
+	Float   float64                    `json:",omitzero"`
+	Str     string                     `json:",omitzero"`
+	Slice   []int                      `json:",omitzero"`
+	Map     map[string]int             `json:",omitzero"`
+	Ptr     *int                       `json:",omitzero"`
+	Array   [2]float64                 `json:",omitzero"`
+	Struct  Inner                      `json:",omitzero"`
+	Time    time.Time                  `json:",omitzero"`
+	TimePtr *time.Time                 `json:",omitzero"`
+	PtrZero PtrZero                    `json:",omitzero"`
+	Iface   interface{}                `json:",omitzero"`
+	Zeroer  interface{ IsZero() bool } `json:",omitzero"`
+	Mixed   struct{ I interface{} }    `json:",omitzero"`
+	Both    []int                      `json:",omitempty,omitzero"`
+}
+
+// Empty has no fields.
+type Empty struct {
+	private int
+}
+
+// Open and Roles have fields with options that canonicaljson-gen does not
+// support.
+type Open struct {
+	Name  string                              `json:"name"`
+	Extra map[string]canonicaljson.RawMessage `json:",inline"`
+}
+
+type Roles struct {
+	Roles []string `json:"roles,set"`
+}
@@ -0,0 +1,716 @@
+// Code generated by canonicaljson-gen -type=Scalars,Composite,Embedding,Addressed,Zeros,Empty; DO NOT EDIT.
+
+package gentest
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v Scalars) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	var err error
+	start := len(dst)
+	dst = append(dst, ",\"-\":"...)
+	dst = strconv.AppendInt(dst, int64(v.Dash), 10)
+	dst = append(dst, ",\"Bool\":"...)
+	dst = strconv.AppendBool(dst, bool(v.Bool))
+	dst = append(dst, ",\"F32\":"...)
+	if dst, err = canonicaljson.AppendFloat(dst, float64(v.F32), 32, false); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Int\":"...)
+	dst = strconv.AppendInt(dst, int64(v.Int), 10)
+	dst = append(dst, ",\"Invalid\":"...)
+	if dst, err = canonicaljson.AppendString(dst, string(v.Invalid), false); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Num\":"...)
+	if dst, err = canonicaljson.AppendNumber(dst, canonicaljson.Number(v.Num)); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"QBool\":"...)
+	dst = append(dst, '"')
+	dst = strconv.AppendBool(dst, bool(v.QBool))
+	dst = append(dst, '"')
+	dst = append(dst, ",\"QFloat\":"...)
+	if dst, err = canonicaljson.AppendFloat(dst, float64(v.QFloat), 64, true); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"QInt\":"...)
+	dst = append(dst, '"')
+	dst = strconv.AppendInt(dst, int64(v.QInt), 10)
+	dst = append(dst, '"')
+	dst = append(dst, ",\"QNum\":"...)
+	if dst, err = canonicaljson.AppendNumber(dst, canonicaljson.Number(v.QNum)); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"QPtr\":"...)
+	if v.QPtr == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '"')
+		dst = strconv.AppendInt(dst, int64(*v.QPtr), 10)
+		dst = append(dst, '"')
+	}
+	dst = append(dst, ",\"QStr\":"...)
+	if dst, err = canonicaljson.AppendString(dst, string(v.QStr), true); err != nil {
+		return nil, err
+	}
+	if v.QUint != 0 {
+		dst = append(dst, ",\"QUint\":"...)
+		dst = append(dst, '"')
+		dst = strconv.AppendUint(dst, uint64(v.QUint), 10)
+		dst = append(dst, '"')
+	}
+	if v.Uintptr != 0 {
+		dst = append(dst, ",\"Uintptr\":"...)
+		dst = strconv.AppendUint(dst, uint64(v.Uintptr), 10)
+	}
+	if v.F64 != 0 {
+		dst = append(dst, ",\"f64\":"...)
+		if dst, err = canonicaljson.AppendFloat(dst, float64(v.F64), 64, false); err != nil {
+			return nil, err
+		}
+	}
+	if v.Flag {
+		dst = append(dst, ",\"flag\":"...)
+		dst = strconv.AppendBool(dst, bool(v.Flag))
+	}
+	dst = append(dst, ",\"i8\":"...)
+	dst = strconv.AppendInt(dst, int64(v.Int8), 10)
+	if len(v.JSONNum) != 0 {
+		dst = append(dst, ",\"jsonNum\":"...)
+		if dst, err = canonicaljson.AppendNumber(dst, canonicaljson.Number(v.JSONNum)); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.Name) != 0 {
+		dst = append(dst, ",\"name\":"...)
+		if dst, err = canonicaljson.AppendString(dst, string(v.Name), false); err != nil {
+			return nil, err
+		}
+	}
+	dst = append(dst, ",\"s\":"...)
+	if dst, err = canonicaljson.AppendString(dst, string(v.Str), false); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"temp\":"...)
+	if dst, err = canonicaljson.AppendFloat(dst, float64(v.Temp), 32, false); err != nil {
+		return nil, err
+	}
+	if v.Uint16 != 0 {
+		dst = append(dst, ",\"u16\":"...)
+		dst = strconv.AppendUint(dst, uint64(v.Uint16), 10)
+	}
+	dst = append(dst, ",\"z-tag/with:punct\":"...)
+	if dst, err = canonicaljson.AppendString(dst, string(v.Tagged), false); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Ünïcode\":"...)
+	if dst, err = canonicaljson.AppendString(dst, string(v.Ünïcode), false); err != nil {
+		return nil, err
+	}
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Scalars) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Scalars) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Scalars_canonicalJSONNames, func(i int) (interface{}, bool) {
+		switch i {
+		case 0:
+			return &v.Dash, false
+		case 1:
+			return &v.Bool, false
+		case 2:
+			return &v.F32, false
+		case 3:
+			return &v.Int, false
+		case 4:
+			return &v.Invalid, false
+		case 5:
+			return &v.Num, false
+		case 6:
+			return &v.QBool, true
+		case 7:
+			return &v.QFloat, true
+		case 8:
+			return &v.QInt, true
+		case 9:
+			return &v.QNum, true
+		case 10:
+			return &v.QPtr, true
+		case 11:
+			return &v.QStr, true
+		case 12:
+			return &v.QUint, true
+		case 13:
+			return &v.Uintptr, false
+		case 14:
+			return &v.F64, false
+		case 15:
+			return &v.Flag, false
+		case 16:
+			return &v.Int8, false
+		case 17:
+			return &v.JSONNum, false
+		case 18:
+			return &v.Name, false
+		case 19:
+			return &v.Str, false
+		case 20:
+			return &v.Temp, false
+		case 21:
+			return &v.Uint16, false
+		case 22:
+			return &v.Tagged, false
+		case 23:
+			return &v.Ünïcode, false
+		}
+		return nil, false
+	}
+}
+
+var _Scalars_canonicalJSONNames = []string{"-", "Bool", "F32", "Int", "Invalid", "Num", "QBool", "QFloat", "QInt", "QNum", "QPtr", "QStr", "QUint", "Uintptr", "f64", "flag", "i8", "jsonNum", "name", "s", "temp", "u16", "z-tag/with:punct", "Ünïcode"}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v *Composite) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	var err error
+	start := len(dst)
+	dst = append(dst, ",\"Array\":"...)
+	dst = append(dst, '[')
+	for i0 := range v.Array {
+		if i0 > 0 {
+			dst = append(dst, ',')
+		}
+		if v.Array[i0] == nil {
+			dst = append(dst, "null"...)
+		} else {
+			if dst, err = canonicaljson.AppendFloat(dst, float64(*v.Array[i0]), 64, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	dst = append(dst, ']')
+	dst = append(dst, ",\"Bytes\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Bytes); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Full\":"...)
+	dst = append(dst, '[')
+	for i0 := range v.Full {
+		if i0 > 0 {
+			dst = append(dst, ',')
+		}
+		dst = strconv.AppendInt(dst, int64(v.Full[i0]), 10)
+	}
+	dst = append(dst, ']')
+	dst = append(dst, ",\"Interface\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Interface); err != nil {
+		return nil, err
+	}
+	if len(v.Ints) != 0 {
+		dst = append(dst, ",\"Ints\":"...)
+		if v.Ints == nil {
+			dst = append(dst, "null"...)
+		} else {
+			dst = append(dst, '[')
+			for i0 := range v.Ints {
+				if i0 > 0 {
+					dst = append(dst, ',')
+				}
+				dst = strconv.AppendInt(dst, int64(v.Ints[i0]), 10)
+			}
+			dst = append(dst, ']')
+		}
+	}
+	dst = append(dst, ",\"Map\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Map); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Nested\":"...)
+	if v.Nested == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i0 := range v.Nested {
+			if i0 > 0 {
+				dst = append(dst, ',')
+			}
+			if v.Nested[i0] == nil {
+				dst = append(dst, "null"...)
+			} else {
+				dst = append(dst, '[')
+				for i1 := range v.Nested[i0] {
+					if i1 > 0 {
+						dst = append(dst, ',')
+					}
+					if dst, err = canonicaljson.AppendString(dst, string(v.Nested[i0][i1]), false); err != nil {
+						return nil, err
+					}
+				}
+				dst = append(dst, ']')
+			}
+		}
+		dst = append(dst, ']')
+	}
+	dst = append(dst, ",\"Ptr\":"...)
+	if v.Ptr == nil {
+		dst = append(dst, "null"...)
+	} else {
+		if dst, err = v.Ptr.AppendCanonicalJSON(dst); err != nil {
+			return nil, err
+		}
+	}
+	dst = append(dst, ",\"PtrPtr\":"...)
+	if v.PtrPtr == nil {
+		dst = append(dst, "null"...)
+	} else {
+		if *v.PtrPtr == nil {
+			dst = append(dst, "null"...)
+		} else {
+			if dst, err = canonicaljson.AppendString(dst, string(**v.PtrPtr), false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	dst = append(dst, ",\"Raw\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, &v.Raw); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Slice\":"...)
+	if v.Slice == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i0 := range v.Slice {
+			if i0 > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = v.Slice[i0].AppendCanonicalJSON(dst); err != nil {
+				return nil, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	if v.Stringer != nil {
+		dst = append(dst, ",\"Stringer\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Stringer); err != nil {
+			return nil, err
+		}
+	}
+	dst = append(dst, ",\"Struct\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Struct); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Time\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Time); err != nil {
+		return nil, err
+	}
+	if v.TimePtr != nil {
+		dst = append(dst, ",\"TimePtr\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.TimePtr); err != nil {
+			return nil, err
+		}
+	}
+	dst = append(dst, ",\"value\":"...)
+	if dst, err = v.Value.AppendCanonicalJSON(dst); err != nil {
+		return nil, err
+	}
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Composite) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Composite) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Composite_canonicalJSONNames, func(i int) (interface{}, bool) {
+		switch i {
+		case 0:
+			return &v.Array, false
+		case 1:
+			return &v.Bytes, false
+		case 2:
+			return &v.Empty, false
+		case 3:
+			return &v.Full, false
+		case 4:
+			return &v.Interface, false
+		case 5:
+			return &v.Ints, false
+		case 6:
+			return &v.Map, false
+		case 7:
+			return &v.Nested, false
+		case 8:
+			return &v.Ptr, false
+		case 9:
+			return &v.PtrPtr, false
+		case 10:
+			return &v.Raw, false
+		case 11:
+			return &v.Slice, false
+		case 12:
+			return &v.Stringer, false
+		case 13:
+			return &v.Struct, false
+		case 14:
+			return &v.Time, false
+		case 15:
+			return &v.TimePtr, false
+		case 16:
+			return &v.Value, false
+		}
+		return nil, false
+	}
+}
+
+var _Composite_canonicalJSONNames = []string{"Array", "Bytes", "Empty", "Full", "Interface", "Ints", "Map", "Nested", "Ptr", "PtrPtr", "Raw", "Slice", "Stringer", "Struct", "Time", "TimePtr", "value"}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v Embedding) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	var err error
+	start := len(dst)
+	if v.Other != nil {
+		dst = append(dst, ",\"C\":"...)
+		dst = strconv.AppendInt(dst, int64(v.Other.E), 10)
+	}
+	dst = append(dst, ",\"b\":"...)
+	dst = strconv.AppendInt(dst, int64(v.Own), 10)
+	dst = append(dst, ",\"tagged\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Tagged); err != nil {
+		return nil, err
+	}
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Embedding) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Embedding) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Embedding_canonicalJSONNames, func(i int) (interface{}, bool) {
+		switch i {
+		case 0:
+			if v.Other == nil {
+				v.Other = new(Other)
+			}
+			return &v.Other.E, false
+		case 1:
+			return &v.Own, false
+		case 2:
+			return &v.Tagged, false
+		}
+		return nil, false
+	}
+}
+
+var _Embedding_canonicalJSONNames = []string{"C", "b", "tagged"}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v *Addressed) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	var err error
+	start := len(dst)
+	dst = append(dst, ",\"Caps\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, &v.Caps); err != nil {
+		return nil, err
+	}
+	dst = append(dst, ",\"Caps2\":"...)
+	if v.Caps2 == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i0 := range v.Caps2 {
+			if i0 > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = canonicaljson.AppendMarshal(dst, &v.Caps2[i0]); err != nil {
+				return nil, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	if v.Hex != 0 {
+		dst = append(dst, ",\"Hex\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, &v.Hex); err != nil {
+			return nil, err
+		}
+	}
+	if v.Inner != nil {
+		dst = append(dst, ",\"Inner\":"...)
+		if v.Inner == nil {
+			dst = append(dst, "null"...)
+		} else {
+			if dst, err = v.Inner.AppendCanonicalJSON(dst); err != nil {
+				return nil, err
+			}
+		}
+	}
+	dst = append(dst, ",\"Ptr\":"...)
+	if dst, err = canonicaljson.AppendMarshal(dst, v.Ptr); err != nil {
+		return nil, err
+	}
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Addressed) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Addressed) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Addressed_canonicalJSONNames, func(i int) (interface{}, bool) {
+		switch i {
+		case 0:
+			return &v.Caps, false
+		case 1:
+			return &v.Caps2, false
+		case 2:
+			return &v.Hex, false
+		case 3:
+			return &v.Inner, false
+		case 4:
+			return &v.Ptr, false
+		}
+		return nil, false
+	}
+}
+
+var _Addressed_canonicalJSONNames = []string{"Caps", "Caps2", "Hex", "Inner", "Ptr"}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v Zeros) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	var err error
+	start := len(dst)
+	if v.Array != ([2]float64{}) {
+		dst = append(dst, ",\"Array\":"...)
+		dst = append(dst, '[')
+		for i0 := range v.Array {
+			if i0 > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = canonicaljson.AppendFloat(dst, float64(v.Array[i0]), 64, false); err != nil {
+				return nil, err
+			}
+		}
+		dst = append(dst, ']')
+	}
+	if len(v.Both) != 0 && v.Both != nil {
+		dst = append(dst, ",\"Both\":"...)
+		if v.Both == nil {
+			dst = append(dst, "null"...)
+		} else {
+			dst = append(dst, '[')
+			for i0 := range v.Both {
+				if i0 > 0 {
+					dst = append(dst, ',')
+				}
+				dst = strconv.AppendInt(dst, int64(v.Both[i0]), 10)
+			}
+			dst = append(dst, ']')
+		}
+	}
+	if v.Float != 0 {
+		dst = append(dst, ",\"Float\":"...)
+		if dst, err = canonicaljson.AppendFloat(dst, float64(v.Float), 64, false); err != nil {
+			return nil, err
+		}
+	}
+	if v.Iface != nil {
+		dst = append(dst, ",\"Iface\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Iface); err != nil {
+			return nil, err
+		}
+	}
+	if v.Int != 0 {
+		dst = append(dst, ",\"Int\":"...)
+		dst = strconv.AppendInt(dst, int64(v.Int), 10)
+	}
+	if v.Map != nil {
+		dst = append(dst, ",\"Map\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Map); err != nil {
+			return nil, err
+		}
+	}
+	if !reflect.ValueOf(v.Mixed).IsZero() {
+		dst = append(dst, ",\"Mixed\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Mixed); err != nil {
+			return nil, err
+		}
+	}
+	if v.Ptr != nil {
+		dst = append(dst, ",\"Ptr\":"...)
+		if v.Ptr == nil {
+			dst = append(dst, "null"...)
+		} else {
+			dst = strconv.AppendInt(dst, int64(*v.Ptr), 10)
+		}
+	}
+	if !(&v.PtrZero).IsZero() {
+		dst = append(dst, ",\"PtrZero\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.PtrZero); err != nil {
+			return nil, err
+		}
+	}
+	if v.Slice != nil {
+		dst = append(dst, ",\"Slice\":"...)
+		if v.Slice == nil {
+			dst = append(dst, "null"...)
+		} else {
+			dst = append(dst, '[')
+			for i0 := range v.Slice {
+				if i0 > 0 {
+					dst = append(dst, ',')
+				}
+				dst = strconv.AppendInt(dst, int64(v.Slice[i0]), 10)
+			}
+			dst = append(dst, ']')
+		}
+	}
+	if len(v.Str) != 0 {
+		dst = append(dst, ",\"Str\":"...)
+		if dst, err = canonicaljson.AppendString(dst, string(v.Str), false); err != nil {
+			return nil, err
+		}
+	}
+	if v.Struct != (Inner{}) {
+		dst = append(dst, ",\"Struct\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Struct); err != nil {
+			return nil, err
+		}
+	}
+	if !v.Time.IsZero() {
+		dst = append(dst, ",\"Time\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Time); err != nil {
+			return nil, err
+		}
+	}
+	if v.TimePtr != nil && !v.TimePtr.IsZero() {
+		dst = append(dst, ",\"TimePtr\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.TimePtr); err != nil {
+			return nil, err
+		}
+	}
+	if v.Zeroer != nil && !(reflect.ValueOf(v.Zeroer).Kind() == reflect.Ptr && reflect.ValueOf(v.Zeroer).IsNil()) && !v.Zeroer.IsZero() {
+		dst = append(dst, ",\"Zeroer\":"...)
+		if dst, err = canonicaljson.AppendMarshal(dst, v.Zeroer); err != nil {
+			return nil, err
+		}
+	}
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Zeros) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Zeros) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Zeros_canonicalJSONNames, func(i int) (interface{}, bool) {
+		switch i {
+		case 0:
+			return &v.Array, false
+		case 1:
+			return &v.Both, false
+		case 2:
+			return &v.Float, false
+		case 3:
+			return &v.Iface, false
+		case 4:
+			return &v.Int, false
+		case 5:
+			return &v.Map, false
+		case 6:
+			return &v.Mixed, false
+		case 7:
+			return &v.Ptr, false
+		case 8:
+			return &v.PtrZero, false
+		case 9:
+			return &v.Slice, false
+		case 10:
+			return &v.Str, false
+		case 11:
+			return &v.Struct, false
+		case 12:
+			return &v.Time, false
+		case 13:
+			return &v.TimePtr, false
+		case 14:
+			return &v.Zeroer, false
+		}
+		return nil, false
+	}
+}
+
+var _Zeros_canonicalJSONNames = []string{"Array", "Both", "Float", "Iface", "Int", "Map", "Mixed", "Ptr", "PtrZero", "Slice", "Str", "Struct", "Time", "TimePtr", "Zeroer"}
+
+// AppendCanonicalJSON appends the canonical JSON encoding of v to dst.
+func (v Empty) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	start := len(dst)
+	if len(dst) == start {
+		return append(dst, "{}"...), nil
+	}
+	dst[start] = '{'
+	return append(dst, '}'), nil
+}
+
+// UnmarshalJSON decodes the JSON object in data into v.
+func (v *Empty) UnmarshalJSON(data []byte) error {
+	names, field := v.CanonicalJSONFields()
+	return canonicaljson.UnmarshalFields(data, v, names, field)
+}
+
+// CanonicalJSONFields returns the JSON member names of v and a function
+// locating their fields, as for canonicaljson.UnmarshalFields.
+func (v *Empty) CanonicalJSONFields() ([]string, func(int) (interface{}, bool)) {
+	return _Empty_canonicalJSONNames, func(i int) (interface{}, bool) {
+		return nil, false
+	}
+}
+
+var _Empty_canonicalJSONNames = []string{}
@@ -0,0 +1,72 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package canonicaljson
+
+import (
+	"io"
+	"iter"
+)
+
+// Values returns an iterator over the JSON values remaining in dec's
+// input stream, each decoded as a T.
+//
+// Iteration ends at the end of input or after yielding the first error.
+func Values[T any](dec *Decoder) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			v, err := DecodeAs[T](dec)
+			if err == io.EOF {
+				return
+			}
+			if !yield(v, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Elements returns an iterator over the elements of the next JSON array
+// in dec's input stream, each decoded as a T. Only one element is read
+// into memory at a time.
+//
+// A JSON null is treated as an empty array; any other non-array value
+// results in an UnmarshalTypeError. Iteration ends after the closing ]
+// or after yielding the first error. If iteration is stopped early, dec
+// is left positioned after the last element yielded.
+func Elements[T any](dec *Decoder) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if err := dec.tokenPrepareForDecode(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if c, err := dec.peek(); err != nil {
+			yield(zero, err)
+			return
+		} else if c != '[' {
+			// Let Decode accept null or describe the mismatch.
+			if err := dec.Decode(new([]T)); err != nil {
+				yield(zero, err)
+			}
+			return
+		}
+		if _, err := dec.Token(); err != nil {
+			yield(zero, err)
+			return
+		}
+		for dec.More() {
+			v, err := DecodeAs[T](dec)
+			if !yield(v, err) || err != nil {
+				return
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
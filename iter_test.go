@@ -0,0 +1,92 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package canonicaljson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	var got []Point
+	for p, err := range Values[Point](NewDecoder(strings.NewReader(`{"Z":1} {"Z":2}` + "\n" + `{"Z":3}`))) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if want := []Point{{1}, {2}, {3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Values = %v, want %v", got, want)
+	}
+
+	n := 0
+	for _, err := range Values[int](NewDecoder(strings.NewReader(`1 "2" 3`))) {
+		n++
+		if n == 2 {
+			if _, ok := err.(*UnmarshalTypeError); !ok {
+				t.Errorf("Values: got error %v, want *UnmarshalTypeError", err)
+			}
+		} else if err != nil {
+			t.Error(err)
+		}
+	}
+	if n != 2 {
+		t.Errorf("Values: iterated %d times after error, want 2", n)
+	}
+}
+
+func TestElements(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`{"points": [{"Z":1}, {"Z":2}], "after": true}`))
+	if tok, err := dec.Token(); err != nil || tok != Delim('{') {
+		t.Fatalf("Token = %v, %v", tok, err)
+	}
+	if tok, err := dec.Token(); err != nil || tok != "points" {
+		t.Fatalf("Token = %v, %v", tok, err)
+	}
+	var got []Point
+	for p, err := range Elements[Point](dec) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if want := []Point{{1}, {2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Elements = %v, want %v", got, want)
+	}
+	if tok, err := dec.Token(); err != nil || tok != "after" {
+		t.Errorf("Token after Elements = %v, %v", tok, err)
+	}
+
+	for _, tt := range []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: `[]`},
+		{in: `null`},
+		{in: `["a", "b"]`, want: []string{"a", "b"}},
+		{in: `["a", 1]`, want: []string{"a"}, err: true},
+		{in: `["a",`, want: []string{"a"}, err: true},
+		{in: `{"a": "b"}`, err: true},
+		{in: `"a"`, err: true},
+	} {
+		var got []string
+		var err error
+		for s, e := range Elements[string](NewDecoder(strings.NewReader(tt.in))) {
+			if e != nil {
+				err = e
+				break
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, tt.want) || (err != nil) != tt.err {
+			t.Errorf("Elements(%s) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
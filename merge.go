@@ -0,0 +1,147 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"bytes"
+	"errors"
+)
+
+// errMergePatchNull is returned by CreateMergePatch when the modified
+// document introduces a null object member, which JSON Merge Patch
+// cannot express.
+var errMergePatchNull = errors.New("canonicaljson: JSON Merge Patch cannot set an object member to null")
+
+// MergePatch applies the JSON Merge Patch patch to the JSON document
+// target as specified by RFC 7396, returning the canonical JSON encoding
+// of the result.
+//
+// Both documents are decoded with numbers represented as Number, so
+// number values pass through with their exact text (subject only to
+// the canonical normalization performed by Marshal).
+func MergePatch(target, patch []byte) ([]byte, error) {
+	t, err := unmarshalGeneric(target)
+	if err != nil {
+		return nil, err
+	}
+	p, err := unmarshalGeneric(patch)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(mergePatch(t, p))
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7396 section 2
+// over decoded values, modifying target objects in place.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// CreateMergePatch returns the canonical JSON encoding of a JSON Merge
+// Patch that transforms the JSON document original into the JSON
+// document modified when applied by MergePatch.
+//
+// Because a null member in a merge patch means deletion, CreateMergePatch
+// returns an error if modified sets an object member to null that is not
+// already null in original.
+func CreateMergePatch(original, modified []byte) ([]byte, error) {
+	o, err := unmarshalGeneric(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := unmarshalGeneric(modified)
+	if err != nil {
+		return nil, err
+	}
+	p, err := createMergePatch(o, m)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(p)
+}
+
+// createMergePatch returns a decoded merge patch from original to modified.
+func createMergePatch(original, modified interface{}) (interface{}, error) {
+	o, ok1 := original.(map[string]interface{})
+	m, ok2 := modified.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if containsNullMember(modified) {
+			return nil, errMergePatchNull
+		}
+		return modified, nil
+	}
+
+	p := map[string]interface{}{}
+	for k := range o {
+		if _, ok := m[k]; !ok {
+			p[k] = nil
+		}
+	}
+	for k, mv := range m {
+		ov, ok := o[k]
+		if ok {
+			same, err := sameValue(ov, mv)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		if mv == nil {
+			return nil, errMergePatchNull
+		}
+		pv, err := createMergePatch(ov, mv)
+		if err != nil {
+			return nil, err
+		}
+		p[k] = pv
+	}
+	return p, nil
+}
+
+// containsNullMember reports whether v has an object at any depth with a
+// null member (arrays are replaced wholesale and so may contain nulls).
+func containsNullMember(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, mv := range m {
+		if mv == nil || containsNullMember(mv) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue reports whether decoded values a and b have identical
+// canonical encodings.
+func sameValue(a, b interface{}) (bool, error) {
+	ab, err := Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test cases from RFC 7396 Appendix A, plus number preservation.
+var mergePatchTests = []struct {
+	target, patch, result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	{`{"n":1}`, `{"m":9007199254740993,"x":100000000000000000000000.0}`,
+		`{"m":9007199254740993,"n":1,"x":100000000000000000000000}`},
+	{`{"n":1}`, `{"n":0.1000000000000000055511151231257827}`,
+		`{"n":1.000000000000000055511151231257827E-1}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for i, tt := range mergePatchTests {
+		got, err := MergePatch([]byte(tt.target), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("#%d: MergePatch(%s, %s): %v", i, tt.target, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.result {
+			t.Errorf("#%d: MergePatch(%s, %s):\n got: %s\nwant: %s", i, tt.target, tt.patch, got, tt.result)
+		}
+	}
+}
+
+func TestMergePatchSyntaxError(t *testing.T) {
+	if _, err := MergePatch([]byte(`{"a":`), []byte(`{}`)); err == nil {
+		t.Error("MergePatch with invalid target: expected error")
+	}
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a"}`)); err == nil {
+		t.Error("MergePatch with invalid patch: expected error")
+	}
+}
+
+var createMergePatchTests = []struct {
+	original, modified, patch string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"a":"b","b":"c"}`, `{"b":"c"}`},
+	{`{"a":"b","b":"c"}`, `{"b":"c"}`, `{"a":null}`},
+	{`{"a":{"b":"c","d":"e"}}`, `{"a":{"b":"d","d":"e"}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[1,2]}`, `{"a":[1,2,null]}`, `{"a":[1,2,null]}`},
+	{`{"a":1.0,"b":null}`, `{"a":1,"b":null}`, `{}`},
+	{`{"a":1}`, `{"a":9007199254740993}`, `{"a":9007199254740993}`},
+	{`["a"]`, `{"a":{"b":1}}`, `{"a":{"b":1}}`},
+	{`{"a":"b"}`, `"c"`, `"c"`},
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	for i, tt := range createMergePatchTests {
+		got, err := CreateMergePatch([]byte(tt.original), []byte(tt.modified))
+		if err != nil {
+			t.Errorf("#%d: CreateMergePatch(%s, %s): %v", i, tt.original, tt.modified, err)
+			continue
+		}
+		if string(got) != tt.patch {
+			t.Errorf("#%d: CreateMergePatch(%s, %s):\n got: %s\nwant: %s", i, tt.original, tt.modified, got, tt.patch)
+			continue
+		}
+
+		// Applying the patch must reproduce the canonical modified document.
+		var m interface{}
+		dec := NewDecoder(strings.NewReader(tt.modified))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		want, err := Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied, err := MergePatch([]byte(tt.original), got)
+		if err != nil {
+			t.Errorf("#%d: MergePatch(%s, %s): %v", i, tt.original, got, err)
+			continue
+		}
+		if string(applied) != string(want) {
+			t.Errorf("#%d: round trip:\n got: %s\nwant: %s", i, applied, want)
+		}
+	}
+}
+
+func TestCreateMergePatchNull(t *testing.T) {
+	for _, tt := range [][2]string{
+		{`{"a":1}`, `{"a":null}`},
+		{`{}`, `{"a":{"b":null}}`},
+		{`[]`, `{"a":null}`},
+	} {
+		if _, err := CreateMergePatch([]byte(tt[0]), []byte(tt[1])); err != errMergePatchNull {
+			t.Errorf("CreateMergePatch(%s, %s): got error %v, want %v", tt[0], tt[1], err, errMergePatchNull)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNumberNotInteger = errors.New("canonicaljson: number is not an integer")
+	errNumberRange      = errors.New("canonicaljson: number out of range")
+	errNumberInfinite   = errors.New("canonicaljson: cannot represent infinite number")
+	errNumberRepeating  = errors.New("canonicaljson: rational number has no finite decimal representation")
+)
+
+// maxIntDigits bounds the number of digits of an integer converted by
+// BigInt, whose value is otherwise computed at a cost that grows with the
+// exponent rather than the length of a Number (as for 1E1000000000). Like
+// the exponent limit of big.Rat.SetString, it rejects only absurd values.
+const maxIntDigits = 1000000
+
+// Bounds of an exponent in a decimal.
+const (
+	maxExp = int(^uint(0) >> 1)
+	minExp = -maxExp - 1
+)
+
+// invalidNumberError returns the error for an invalid Number.
+func invalidNumberError(n Number) error {
+	return errors.New("canonicaljson: invalid number literal " + strconv.Quote(string(n)))
+}
+
+// Canonical returns n in canonical form, as it would be encoded by Marshal.
+func (n Number) Canonical() (Number, error) {
+	if !isValidNumber(string(n)) {
+		return "", invalidNumberError(n)
+	}
+	return Number(canonicalNumber([]byte(n))), nil
+}
+
+// A decimal is the exact value of a Number: 0.digits × 10**exp, negated
+// if neg. It has no leading or trailing zeros in digits, which are empty
+// for zero (which is never negative).
+type decimal struct {
+	neg    bool
+	digits string
+	exp    int
+}
+
+// decimal returns the exact value of n.
+func (n Number) decimal() (decimal, error) {
+	s := string(n)
+	if !isValidNumber(s) {
+		return decimal{}, invalidNumberError(n)
+	}
+	var d decimal
+	if s[0] == '-' {
+		d.neg = true
+		s = s[1:]
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(strings.TrimPrefix(s[i+1:], "+"))
+		if err != nil {
+			return decimal{}, errNumberRange
+		}
+		d.exp, s = exp, s[:i]
+	}
+	point := strings.IndexByte(s, '.')
+	if point < 0 {
+		point = len(s)
+	} else {
+		s = s[:point] + s[point+1:]
+	}
+
+	// Strip insignificant zeros.
+	digits := strings.TrimLeft(s, "0")
+	d.digits = strings.TrimRight(digits, "0")
+	if d.digits == "" {
+		return decimal{}, nil
+	}
+
+	// Adjust the exponent for the position of the decimal point and the
+	// leading zeros, which must not overflow.
+	adj := point - (len(s) - len(digits))
+	if adj > 0 && d.exp > maxExp-adj || adj < 0 && d.exp < minExp-adj {
+		return decimal{}, errNumberRange
+	}
+	d.exp += adj
+	return d, nil
+}
+
+// isInteger reports whether d has no fractional part.
+func (d decimal) isInteger() bool {
+	return len(d.digits) <= d.exp
+}
+
+// IsInteger reports whether n has an integer value (such as 1.5E3).
+func (n Number) IsInteger() (bool, error) {
+	d, err := n.decimal()
+	if err != nil {
+		return false, err
+	}
+	return d.isInteger(), nil
+}
+
+// Compare compares the exact values of n and m, returning -1 if n < m, 0
+// if n == m, and +1 if n > m.
+func (n Number) Compare(m Number) (int, error) {
+	a, err := n.decimal()
+	if err != nil {
+		return 0, err
+	}
+	b, err := m.decimal()
+	if err != nil {
+		return 0, err
+	}
+	sign := 1
+	switch {
+	case a.neg != b.neg:
+		if a.neg {
+			return -1, nil
+		}
+		return 1, nil
+	case a.neg:
+		sign = -1
+	}
+
+	// Compare magnitudes, with zero (and only zero) having empty digits.
+	var c int
+	switch {
+	case a.digits == "" || b.digits == "":
+		c = len(a.digits) - len(b.digits)
+	case a.exp < b.exp:
+		c = -1
+	case a.exp > b.exp:
+		c = 1
+	default:
+		c = strings.Compare(a.digits, b.digits)
+	}
+	switch {
+	case c < 0:
+		return -sign, nil
+	case c > 0:
+		return sign, nil
+	}
+	return 0, nil
+}
+
+// Uint64 returns n as a uint64, if it is an integer in range.
+func (n Number) Uint64() (uint64, error) {
+	d, err := n.decimal()
+	if err != nil {
+		return 0, err
+	}
+	if !d.isInteger() {
+		return 0, errNumberNotInteger
+	}
+	// The largest uint64 has 20 digits.
+	if d.neg || d.exp > 20 {
+		return 0, errNumberRange
+	}
+	i := d.bigInt()
+	if !i.IsUint64() {
+		return 0, errNumberRange
+	}
+	return i.Uint64(), nil
+}
+
+// BigInt returns n as a *big.Int, if it is an integer of at most a million
+// digits.
+func (n Number) BigInt() (*big.Int, error) {
+	d, err := n.decimal()
+	if err != nil {
+		return nil, err
+	}
+	if !d.isInteger() {
+		return nil, errNumberNotInteger
+	}
+	if d.exp > maxIntDigits {
+		return nil, errNumberRange
+	}
+	return d.bigInt(), nil
+}
+
+// bigInt returns the value of d, which must be an integer.
+func (d decimal) bigInt() *big.Int {
+	i := new(big.Int)
+	if d.digits == "" {
+		return i
+	}
+	i.SetString(d.digits, 10)
+	if zeros := d.exp - len(d.digits); zeros > 0 {
+		i.Mul(i, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(zeros)), nil))
+	}
+	if d.neg {
+		i.Neg(i)
+	}
+	return i
+}
+
+// Rat returns the exact value of n as a *big.Rat.
+func (n Number) Rat() (*big.Rat, error) {
+	if !isValidNumber(string(n)) {
+		return nil, invalidNumberError(n)
+	}
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, errNumberRange
+	}
+	return r, nil
+}
+
+// BigFloat returns n as a *big.Float, with enough precision for all of its
+// significant digits (although its value is exact only if it is a binary
+// fraction; see Rat).
+func (n Number) BigFloat() (*big.Float, error) {
+	d, err := n.decimal()
+	if err != nil {
+		return nil, err
+	}
+	prec := uint(len(d.digits))*4 + 64
+	f, _, err := big.ParseFloat(string(n), 10, prec, big.ToNearestEven)
+	if err != nil || f.IsInf() {
+		return nil, errNumberRange
+	}
+	return f, nil
+}
+
+// NumberFromBigInt returns the canonical Number for x.
+func NumberFromBigInt(x *big.Int) Number {
+	return Number(x.String())
+}
+
+// NumberFromRat returns the canonical Number for x, which must have a
+// finite decimal representation (i.e., its denominator must have no prime
+// factors other than 2 and 5).
+func NumberFromRat(x *big.Rat) (Number, error) {
+	if x.IsInt() {
+		return NumberFromBigInt(x.Num()), nil
+	}
+
+	// Find the power of 10 that scales x to an integer.
+	denom := new(big.Int).Set(x.Denom())
+	scale := 0
+	ten, rem := big.NewInt(10), new(big.Int)
+	for _, p := range []int64{2, 5} {
+		bp := big.NewInt(p)
+		k := 0
+		for {
+			q, r := new(big.Int).QuoRem(denom, bp, rem)
+			if r.Sign() != 0 {
+				break
+			}
+			denom, k = q, k+1
+		}
+		if k > scale {
+			scale = k
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return "", errNumberRepeating
+	}
+	num := new(big.Int).Exp(ten, big.NewInt(int64(scale)), nil)
+	num.Mul(num, x.Num()).Quo(num, x.Denom())
+	s := num.String() + "E-" + strconv.Itoa(scale)
+	return Number(canonicalNumber([]byte(s))), nil
+}
+
+// NumberFromBigFloat returns the canonical Number for the exact value of
+// x, which must be finite.
+func NumberFromBigFloat(x *big.Float) (Number, error) {
+	if x.IsInf() {
+		return "", errNumberInfinite
+	}
+	r, _ := x.Rat(nil)
+	return NumberFromRat(r)
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestNumberCanonical(t *testing.T) {
+	for _, tt := range []struct {
+		in, want Number
+	}{
+		{"0", "0"},
+		{"-0.0", "0"},
+		{"1.50e+2", "150"},
+		{"0.001", "1.0E-3"},
+		{"-12345678901234567890.5", "-1.23456789012345678905E19"},
+	} {
+		got, err := tt.in.Canonical()
+		if err != nil {
+			t.Errorf("Number(%q).Canonical(): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("Number(%q).Canonical() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if _, err := Number("01").Canonical(); err == nil {
+		t.Error(`Number("01").Canonical(): expected error`)
+	}
+}
+
+func TestNumberCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b Number
+		want int
+	}{
+		{"0", "-0.0E5", 0},
+		{"1", "1.0", 0},
+		{"1.5E2", "150", 0},
+		{"0.1", "1E-1", 0},
+		{"1", "0", 1},
+		{"-1", "0", -1},
+		{"-1", "-2", 1},
+		{"9007199254740993", "9007199254740992", 1},
+		{"0.30000000000000001", "0.3", 1},
+		{"1E-400", "0", 1},
+		{"1E1000000000", "9.9E999999999", 1},
+		{"-123", "-1230E-1", 0},
+		{"12", "123E-1", -1},
+		{"0.1E9223372036854775807", "1", 1},
+		{"1E-9223372036854775808", "1", -1},
+		{"-0.1E9223372036854775807", "9.9E9223372036854775806", -1},
+	} {
+		got, err := tt.a.Compare(tt.b)
+		if err != nil {
+			t.Errorf("Number(%q).Compare(%q): %v", tt.a, tt.b, err)
+		} else if got != tt.want {
+			t.Errorf("Number(%q).Compare(%q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if rev, _ := tt.b.Compare(tt.a); rev != -tt.want {
+			t.Errorf("Number(%q).Compare(%q) = %d, want %d", tt.b, tt.a, rev, -tt.want)
+		}
+	}
+	if _, err := Number("1").Compare("x"); err == nil {
+		t.Error(`Number("1").Compare("x"): expected error`)
+	}
+
+	// Exponents beyond the range of int are rejected rather than wrapping.
+	for _, n := range []Number{"10E9223372036854775807", "0.001E-9223372036854775808"} {
+		if c, err := n.Compare("1"); err != errNumberRange {
+			t.Errorf("Number(%q).Compare(\"1\") = %d, %v; want error %v", n, c, err, errNumberRange)
+		}
+		if ok, err := n.IsInteger(); err != errNumberRange {
+			t.Errorf("Number(%q).IsInteger() = %v, %v; want error %v", n, ok, err, errNumberRange)
+		}
+	}
+	if ok, err := Number("0.1E9223372036854775807").IsInteger(); !ok || err != nil {
+		t.Errorf(`Number("0.1E9223372036854775807").IsInteger() = %v, %v; want true`, ok, err)
+	}
+}
+
+func TestNumberIntegers(t *testing.T) {
+	for _, tt := range []struct {
+		in      Number
+		integer bool
+		big     string
+		uint64  uint64
+		uintErr bool
+	}{
+		{"0", true, "0", 0, false},
+		{"-0", true, "0", 0, false},
+		{"1.5E3", true, "1500", 1500, false},
+		{"18446744073709551615", true, "18446744073709551615", 1<<64 - 1, false},
+		{"18446744073709551616", true, "18446744073709551616", 0, true},
+		{"1.8446744073709551615E20", true, "184467440737095516150", 0, true},
+		{"-1", true, "-1", 0, true},
+		{"1.5", false, "", 0, true},
+		{"1E-400", false, "", 0, true},
+		{"1E1000000000", true, "", 0, true},
+		{"-1E1000000000", true, "", 0, true},
+	} {
+		if got, err := tt.in.IsInteger(); err != nil || got != tt.integer {
+			t.Errorf("Number(%q).IsInteger() = %v, %v; want %v", tt.in, got, err, tt.integer)
+		}
+		i, err := tt.in.BigInt()
+		switch {
+		case tt.big == "" && err == nil:
+			t.Errorf("Number(%q).BigInt(): expected error", tt.in)
+		case tt.big != "" && (err != nil || i.String() != tt.big):
+			t.Errorf("Number(%q).BigInt() = %v, %v; want %s", tt.in, i, err, tt.big)
+		}
+		u, err := tt.in.Uint64()
+		if (err != nil) != tt.uintErr || u != tt.uint64 {
+			t.Errorf("Number(%q).Uint64() = %d, %v; want %d", tt.in, u, err, tt.uint64)
+		}
+	}
+
+	// Integers are limited to a million digits.
+	if i, err := Number("1E999999").BigInt(); err != nil || len(i.String()) != 1000000 {
+		t.Errorf(`Number("1E999999").BigInt(): %v`, err)
+	}
+	if _, err := Number("1E1000000").BigInt(); err != errNumberRange {
+		t.Errorf(`Number("1E1000000").BigInt(): got error %v, want %v`, err, errNumberRange)
+	}
+}
+
+func TestNumberBig(t *testing.T) {
+	r, err := Number("-1.25E-1").Rat()
+	if err != nil || r.Cmp(big.NewRat(-1, 8)) != 0 {
+		t.Errorf(`Number("-1.25E-1").Rat() = %v, %v; want -1/8`, r, err)
+	}
+	f, err := Number("9007199254740993").BigFloat()
+	if err != nil || f.Text('f', -1) != "9007199254740993" {
+		t.Errorf(`Number("9007199254740993").BigFloat() = %v, %v`, f, err)
+	}
+	if f, err := Number("1E1000000000").BigFloat(); err != errNumberRange {
+		t.Errorf(`Number("1E1000000000").BigFloat() = %v, %v; want error %v`, f, err, errNumberRange)
+	}
+	if _, err := Number("").Rat(); err == nil {
+		t.Error(`Number("").Rat(): expected error`)
+	}
+
+	if got := NumberFromBigInt(big.NewInt(-42)); got != "-42" {
+		t.Errorf("NumberFromBigInt(-42) = %q", got)
+	}
+	for _, tt := range []struct {
+		in   *big.Rat
+		want Number
+	}{
+		{big.NewRat(3, 1), "3"},
+		{big.NewRat(-1, 8), "-1.25E-1"},
+		{big.NewRat(7, 20), "3.5E-1"},
+		{big.NewRat(1, 3), ""},
+	} {
+		got, err := NumberFromRat(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("NumberFromRat(%v): expected error", tt.in)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("NumberFromRat(%v) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if got, err := NumberFromBigFloat(big.NewFloat(0.1)); err != nil || got != "1.000000000000000055511151231257827021181583404541015625E-1" {
+		t.Errorf("NumberFromBigFloat(0.1) = %q, %v", got, err)
+	}
+	if _, err := NumberFromBigFloat(new(big.Float).SetInf(false)); err == nil {
+		t.Error("NumberFromBigFloat(+Inf): expected error")
+	}
+}
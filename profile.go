@@ -0,0 +1,455 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Profile is a dialect of canonical JSON, for interoperating with systems
+// that specify their own. Every profile agrees with canonical JSON on
+// structure, member order (by code point, which is also byte order), and
+// the absence of insignificant whitespace, differing only in how strings
+// are escaped and which numbers are allowed. A profile's encoding of a value
+// is therefore derived from its canonical encoding.
+type Profile int
+
+const (
+	// Canonical is canonical JSON as specified at
+	// https://gibson042.github.io/canonicaljson-spec/, the encoding
+	// produced by Marshal.
+	Canonical Profile = iota
+
+	// OLPC is the canonical JSON of the One Laptop per Child project,
+	// used by The Update Framework (TUF) and in-toto by way of
+	// securesystemslib. Numbers must be integers, and strings escape only
+	// quotation mark and reverse solidus, with every other character
+	// (including control characters) represented literally. Output with
+	// control characters is therefore not valid JSON.
+	OLPC
+
+	// Matrix is the canonical JSON of the Matrix specification, used for
+	// signing events. Numbers must be integers in the range
+	// [-(2**53)+1, (2**53)-1], and strings are as in canonical JSON except
+	// that Unicode escapes (used only for control characters without a
+	// shorter escape) have lowercase hex digits.
+	Matrix
+)
+
+// maxMatrixInteger is the largest magnitude of an integer in Matrix.
+const maxMatrixInteger = 1<<53 - 1
+
+var profileNames = [...]string{
+	Canonical: "Canonical",
+	OLPC:      "OLPC",
+	Matrix:    "Matrix",
+}
+
+func (p Profile) String() string {
+	if p >= 0 && int(p) < len(profileNames) {
+		return profileNames[p]
+	}
+	return "Profile(" + strconv.Itoa(int(p)) + ")"
+}
+
+// A ProfileError describes a value that cannot be represented in a Profile.
+type ProfileError struct {
+	Profile Profile
+	Path    string // JSON Pointer (RFC 6901) to the value
+	Reason  string
+}
+
+func (e *ProfileError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return "canonicaljson: " + e.Profile.String() + " profile cannot represent value at " + path + ": " + e.Reason
+}
+
+// Marshal returns the encoding of v in profile p. It is like the
+// package-level Marshal (and for Canonical, identical to it), but returns a
+// ProfileError for any value that p cannot represent.
+func (p Profile) Marshal(v interface{}) ([]byte, error) {
+	b, err := Marshal(v)
+	if err != nil || p == Canonical {
+		return b, err
+	}
+	return p.fromCanonical(b)
+}
+
+// Check returns nil if data is a single value encoded exactly as p.Marshal
+// would encode it. Otherwise it returns a SyntaxError for invalid input, a
+// ProfileError for a value that p cannot represent, or a
+// NonCanonicalError for any other difference. For Canonical, it is
+// identical to CheckCanonical.
+func (p Profile) Check(data []byte) error {
+	if p == Canonical {
+		return CheckCanonical(data)
+	}
+	want, err := p.parse(data)
+	if err != nil {
+		return err
+	}
+	i := 0
+	for i < len(data) && i < len(want) && data[i] == want[i] {
+		i++
+	}
+	if i < len(data) || i < len(want) {
+		return &NonCanonicalError{int64(i)}
+	}
+	return nil
+}
+
+// Unmarshal is like the package-level Unmarshal, but first returns a
+// ProfileError if data contains any value that p cannot represent. The
+// input need not be encoded exactly as p.Marshal would encode it (see
+// Check), although for OLPC it may include literal control characters in
+// strings.
+func (p Profile) Unmarshal(data []byte, v interface{}) error {
+	if p == Canonical {
+		return Unmarshal(data, v)
+	}
+	j, expanded := p.toJSON(data)
+	err := p.validate(j)
+	if err == nil {
+		err = Unmarshal(j, v)
+	}
+	switch err := err.(type) {
+	case *SyntaxError:
+		err.Offset = originalOffset(err.Offset, expanded)
+	case *UnmarshalTypeError:
+		err.Offset = originalOffset(err.Offset, expanded)
+	}
+	return err
+}
+
+// validate returns a SyntaxError if j (as returned by toJSON) is not a
+// single valid JSON value, or else a ProfileError for the first number in
+// it that p cannot represent, in a single pass over j. Strings need no
+// check, because decoding them never yields a lone surrogate.
+func (p Profile) validate(j []byte) error {
+	var scan scanner
+	scan.reset()
+	var path pointer
+	lit, key := -1, false // start of the current literal, and whether it is a key
+	for i := 0; ; i++ {
+		if i < len(j) && scan.run != runNone {
+			n := scan.continueRun(j[i:])
+			scan.bytes += int64(n)
+			i += n
+		}
+		var op int
+		if i < len(j) {
+			scan.bytes++
+			op = scan.step(&scan, j[i])
+		} else {
+			op = scan.eof()
+		}
+		if op == scanError {
+			return scan.err
+		}
+
+		if lit >= 0 && op != scanContinue {
+			if key {
+				path[len(path)-1].key = j[lit:i]
+			} else if c := j[lit]; c == '-' || '0' <= c && c <= '9' {
+				if err := p.checkNumber(j[lit:i], path); err != nil {
+					return err
+				}
+			}
+			lit = -1
+		}
+		switch op {
+		case scanBeginLiteral:
+			lit = i
+			n := len(scan.parseState)
+			key = n > 0 && scan.parseState[n-1] == parseObjectKey
+		case scanBeginObject:
+			path = append(path, pointerToken{key: noKey})
+		case scanBeginArray:
+			path = append(path, pointerToken{})
+		case scanArrayValue:
+			path[len(path)-1].index++
+		case scanEndObject, scanEndArray:
+			path = path[:len(path)-1]
+		}
+		if i >= len(j) {
+			return nil
+		}
+	}
+}
+
+// checkNumber returns a ProfileError if p cannot represent the valid JSON
+// number num, found at path.
+func (p Profile) checkNumber(num []byte, path pointer) error {
+	d, err := Number(num).decimal()
+	switch {
+	case err != nil:
+		return &ProfileError{p, path.String(), "number " + string(num) + " out of range"}
+	case !d.isInteger():
+		return &ProfileError{p, path.String(), "non-integer number " + canonicalNumber(num)}
+	case p != Matrix:
+		return nil
+	case d.exp > 16:
+		// Too many digits for any integer in range (or to write out).
+		return &ProfileError{p, path.String(), "integer " + string(num) + " out of range"}
+	}
+	c := canonicalNumber(num)
+	if n, err := strconv.ParseInt(c, 10, 64); err != nil || n > maxMatrixInteger || n < -maxMatrixInteger {
+		return &ProfileError{p, path.String(), "integer " + c + " out of range"}
+	}
+	return nil
+}
+
+// parse parses data as encoded in profile p, returning the encoding of its
+// value in p.
+func (p Profile) parse(data []byte) ([]byte, error) {
+	j, expanded := p.toJSON(data)
+	v, err := unmarshalGeneric(j)
+	if se, ok := err.(*SyntaxError); ok {
+		se.Offset = originalOffset(se.Offset, expanded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return p.fromCanonical(canonical)
+}
+
+// toJSON returns data, as encoded in profile p, in a form that can be
+// parsed as JSON, along with the ascending offsets of any characters in
+// data that were expanded into escape sequences.
+func (p Profile) toJSON(data []byte) ([]byte, []int) {
+	if p != OLPC || bytes.IndexFunc(data, func(r rune) bool { return r < ' ' }) < 0 {
+		return data, nil
+	}
+
+	// Escape literal control characters in strings.
+	out := make([]byte, 0, len(data)+16)
+	var expanded []int
+	inString, escaped := false, false
+	for i, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString && c < ' ':
+			out = append(out, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			expanded = append(expanded, i)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, expanded
+}
+
+// originalOffset maps an offset in the output of toJSON back to its input,
+// given the offsets of characters that toJSON expanded into (six-byte)
+// escape sequences.
+func originalOffset(off int64, expanded []int) int64 {
+	shift := int64(0)
+	for _, i := range expanded {
+		start := int64(i) + shift
+		if off <= start {
+			break
+		}
+		if off < start+6 {
+			// Within the escape sequence.
+			return int64(i) + 1
+		}
+		shift += 5
+	}
+	return off - shift
+}
+
+// A pointer is a JSON Pointer (RFC 6901) kept as a stack of reference
+// tokens, so that it is formatted only for a ProfileError.
+type pointer []pointerToken
+
+// A pointerToken refers to the object member named by key (a JSON string,
+// or noKey before the name of the member is known) or, if key is nil, to
+// the array element at index.
+type pointerToken struct {
+	key   []byte
+	index int
+}
+
+// noKey is the key of a pointerToken for an object before its first member.
+var noKey = []byte{}
+
+func (ptr pointer) String() string {
+	var b []byte
+	for _, t := range ptr {
+		switch {
+		case t.key == nil:
+			b = append(b, '/')
+			b = strconv.AppendInt(b, int64(t.index), 10)
+		case len(t.key) > 0:
+			key, _ := unquote(t.key)
+			b = append(b, '/')
+			b = append(b, escapePointerToken(key)...)
+		}
+	}
+	return string(b)
+}
+
+// fromCanonical converts the canonical encoding of a value to profile p.
+func (p Profile) fromCanonical(canonical []byte) ([]byte, error) {
+	pe := profileEncoder{p: p, in: canonical, out: make([]byte, 0, len(canonical))}
+	if err := pe.value(); err != nil {
+		return nil, err
+	}
+	return pe.out, nil
+}
+
+// profileEncoder converts canonical JSON to a Profile. Its input is
+// trusted to be canonical, and so is not checked for validity.
+type profileEncoder struct {
+	p    Profile
+	in   []byte
+	off  int
+	out  []byte
+	path pointer // to the value at off
+}
+
+// error returns a ProfileError for the value at pe.path.
+func (pe *profileEncoder) error(reason string) error {
+	return &ProfileError{pe.p, pe.path.String(), reason}
+}
+
+// value converts the value at pe.off.
+func (pe *profileEncoder) value() error {
+	switch c := pe.in[pe.off]; c {
+	case '{':
+		pe.out = append(pe.out, c)
+		pe.off++
+		n := len(pe.path)
+		pe.path = append(pe.path, pointerToken{key: noKey})
+		for pe.in[pe.off] != '}' {
+			if pe.in[pe.off] == ',' {
+				pe.out = append(pe.out, ',')
+				pe.off++
+			}
+			pe.path[n].key = noKey
+			start := pe.off
+			if err := pe.string(); err != nil {
+				return err
+			}
+			pe.path[n].key = pe.in[start:pe.off]
+			pe.out = append(pe.out, ':')
+			pe.off++
+			if err := pe.value(); err != nil {
+				return err
+			}
+		}
+		pe.path = pe.path[:n]
+		pe.out = append(pe.out, '}')
+		pe.off++
+	case '[':
+		pe.out = append(pe.out, c)
+		pe.off++
+		n := len(pe.path)
+		pe.path = append(pe.path, pointerToken{})
+		for i := 0; pe.in[pe.off] != ']'; i++ {
+			if pe.in[pe.off] == ',' {
+				pe.out = append(pe.out, ',')
+				pe.off++
+			}
+			pe.path[n].index = i
+			if err := pe.value(); err != nil {
+				return err
+			}
+		}
+		pe.path = pe.path[:n]
+		pe.out = append(pe.out, ']')
+		pe.off++
+	case '"':
+		return pe.string()
+	case 't', 'f', 'n':
+		end := pe.off + 4
+		if c == 'f' {
+			end++
+		}
+		pe.out = append(pe.out, pe.in[pe.off:end]...)
+		pe.off = end
+	default:
+		end := pe.off + 1
+		for end < len(pe.in) && pe.in[end] != ',' && pe.in[end] != ']' && pe.in[end] != '}' {
+			end++
+		}
+		num := pe.in[pe.off:end]
+		if bytes.IndexByte(num, 'E') >= 0 {
+			return pe.error("non-integer number " + string(num))
+		}
+		if pe.p == Matrix {
+			n, err := strconv.ParseInt(string(num), 10, 64)
+			if err != nil || n > maxMatrixInteger || n < -maxMatrixInteger {
+				return pe.error("integer " + string(num) + " out of range")
+			}
+		}
+		pe.out = append(pe.out, num...)
+		pe.off = end
+	}
+	return nil
+}
+
+// string converts the string at pe.off.
+func (pe *profileEncoder) string() error {
+	pe.out = append(pe.out, '"')
+	pe.off++
+	for {
+		c := pe.in[pe.off]
+		if c == '"' {
+			pe.out = append(pe.out, c)
+			pe.off++
+			return nil
+		}
+		if c != '\\' {
+			pe.out = append(pe.out, c)
+			pe.off++
+			continue
+		}
+
+		esc := pe.in[pe.off : pe.off+2]
+		if esc[1] == 'u' {
+			esc = pe.in[pe.off : pe.off+6]
+			if !utf8.ValidRune(getu4(esc)) {
+				return pe.error("lone surrogate " + string(esc))
+			}
+		}
+		pe.off += len(esc)
+		switch {
+		case pe.p == Matrix && esc[1] == 'u':
+			// Use lowercase hex digits, like Python's json module.
+			pe.out = append(pe.out, esc[:2]...)
+			pe.out = append(pe.out, bytes.ToLower(esc[2:])...)
+		case pe.p == Matrix, esc[1] == '"', esc[1] == '\\':
+			pe.out = append(pe.out, esc...)
+		case esc[1] == 'u':
+			pe.out = append(pe.out, string(getu4(esc))...)
+		default:
+			pe.out = append(pe.out, unescapeShort[esc[1]])
+		}
+	}
+}
+
+// unescapeShort maps the character after a reverse solidus in a
+// two-character JSON string escape sequence to the character it represents.
+var unescapeShort = map[byte]byte{
+	'b': '\b',
+	'f': '\f',
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+}
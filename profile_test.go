@@ -0,0 +1,136 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"reflect"
+	"testing"
+)
+
+var profileMarshalTests = []struct {
+	profile Profile
+	in      interface{}
+	want    string
+	err     error
+}{
+	{Canonical, map[string]interface{}{"s": "\né", "n": 1.5}, `{"n":1.5E0,"s":"\n` + "é" + `"}`, nil},
+	{OLPC, map[string]interface{}{
+		"b": "q\"r\\s\n\x01\x1fé ",
+		"a": []interface{}{1, -2, 1e3, true, nil, Number("1E30")},
+	}, `{"a":[1,-2,1000,true,null,1000000000000000000000000000000],"b":"q\"r\\s` + "\n\x01\x1fé " + `"}`, nil},
+	{OLPC, struct {
+		Keys map[string]interface{} `json:"keys"`
+	}{map[string]interface{}{"x/y~": []float64{1, 0.5}}}, "", &ProfileError{OLPC, "/keys/x~1y~0/1", "non-integer number 5.0E-1"}},
+	{OLPC, 1e-3, "", &ProfileError{OLPC, "", "non-integer number 1.0E-3"}},
+	{OLPC, []string{"\xed\xa0\x80"}, "", &ProfileError{OLPC, "/0", `lone surrogate \uD800`}},
+	{Matrix, map[string]interface{}{
+		"s": "\x1f\"\\\n日本語",
+		"n": []int64{1<<53 - 1, -1<<53 + 1, 0},
+		"f": 2.0,
+	}, `{"f":2,"n":[9007199254740991,-9007199254740991,0],"s":"\u001f\"\\\n日本語"}`, nil},
+	{Matrix, map[string]interface{}{"n": []int64{0, 1 << 53}}, "", &ProfileError{Matrix, "/n/1", "integer 9007199254740992 out of range"}},
+	{Matrix, map[string]interface{}{"a": Number("-1E16")}, "", &ProfileError{Matrix, "/a", "integer -10000000000000000 out of range"}},
+	{Matrix, map[string]interface{}{"~": 0.5}, "", &ProfileError{Matrix, "/~0", "non-integer number 5.0E-1"}},
+	{Matrix, "\xed\xb0\x80", "", &ProfileError{Matrix, "", `lone surrogate \uDC00`}},
+}
+
+func TestProfileMarshal(t *testing.T) {
+	for _, tt := range profileMarshalTests {
+		got, err := tt.profile.Marshal(tt.in)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("%v.Marshal(%#v): got error %v, want %v", tt.profile, tt.in, err, tt.err)
+		} else if string(got) != tt.want {
+			t.Errorf("%v.Marshal(%#v) = %q, want %q", tt.profile, tt.in, got, tt.want)
+		}
+	}
+}
+
+var profileCheckTests = []struct {
+	profile Profile
+	in      string
+	err     error
+}{
+	{Canonical, `{"a":[1,1.0E-1]}`, nil},
+	{Canonical, `{"a":[1,0.1]}`, &NonCanonicalError{8}},
+	{OLPC, `{"_type":"root","keys":{},"version":1}`, nil},
+	{OLPC, "{\"a\":\"\n\x01\\\\\\\"é\"}", nil},
+	{OLPC, `{"a":"\n"}`, &NonCanonicalError{6}},
+	{OLPC, `{"a":"\u00e9"}`, &NonCanonicalError{6}},
+	{OLPC, `{"b":1,"a":2}`, &NonCanonicalError{2}},
+	{OLPC, `[1, 2]`, &NonCanonicalError{3}},
+	{OLPC, `[1.0]`, &NonCanonicalError{2}},
+	{OLPC, `{"a":[0.5]}`, &ProfileError{OLPC, "/a/0", "non-integer number 5.0E-1"}},
+	{OLPC, "[1,\"\x01", &SyntaxError{"unexpected end of JSON input", 5}},
+	{OLPC, "[\"\x01\x02\",}", &SyntaxError{"invalid character '}' looking for beginning of value", 7}},
+	{Matrix, `{"a":"\u001f","b":9007199254740991}`, nil},
+	{Matrix, `{"a":"\u001F"}`, &NonCanonicalError{11}},
+	{Matrix, `{"a":9007199254740992}`, &ProfileError{Matrix, "/a", "integer 9007199254740992 out of range"}},
+}
+
+func TestProfileCheck(t *testing.T) {
+	for _, tt := range profileCheckTests {
+		err := tt.profile.Check([]byte(tt.in))
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("%v.Check(%q) = %#v, want %#v", tt.profile, tt.in, err, tt.err)
+		}
+	}
+}
+
+// Converting to a profile allocates for its output and the depth of the
+// input, but not for the path to each value.
+func TestProfileConvertAllocs(t *testing.T) {
+	allocs := func(n int) float64 {
+		in := []interface{}{}
+		for i := 0; i < n; i++ {
+			in = append(in, map[string]interface{}{"k": []int{i}, "s": "x"})
+		}
+		canonical, err := Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testing.AllocsPerRun(10, func() {
+			if _, err := OLPC.fromCanonical(canonical); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if few, many := allocs(2), allocs(200); many != few {
+		t.Errorf("OLPC.fromCanonical: %v allocations for 200 elements, but %v for 2", many, few)
+	}
+}
+
+func TestProfileUnmarshal(t *testing.T) {
+	type record struct {
+		N int
+		S string
+	}
+	for _, tt := range []struct {
+		profile Profile
+		in      string
+		want    interface{}
+		err     error
+	}{
+		{Matrix, ` {"N": 2, "S": "\u00E9"} `, record{2, "é"}, nil},
+		{Matrix, `{"N": 2, "S": "x", "z": [true, {"y": 1.5}]}`, record{}, &ProfileError{Matrix, "/z/1/y", "non-integer number 1.5E0"}},
+		{Matrix, `{"N": -9007199254740992}`, record{}, &ProfileError{Matrix, "/N", "integer -9007199254740992 out of range"}},
+		{OLPC, "{\"N\":1,\"S\":\"\x01\x02\"}", record{1, "\x01\x02"}, nil},
+		{OLPC, "{\"S\":\"\x01\",\"N\":true}", record{S: "\x01"}, &UnmarshalTypeError{"bool", reflect.TypeOf(0), 17}},
+		{OLPC, `{"N":1E400,"S":[0.5]}`, record{}, &ProfileError{OLPC, "/S/0", "non-integer number 5.0E-1"}},
+		{Matrix, `{"": [1, {"x": 0, "b~/": [0, 2.50]}]}`, record{}, &ProfileError{Matrix, "//1/b~0~1/1", "non-integer number 2.5E0"}},
+		{Matrix, `[1E1000000000]`, record{}, &ProfileError{Matrix, "/0", "integer 1E1000000000 out of range"}},
+		{OLPC, `[1E99999999999999999999]`, record{}, &ProfileError{OLPC, "/0", "number 1E99999999999999999999 out of range"}},
+		{OLPC, "{\"S\":\"\x01\",}", record{}, &SyntaxError{"invalid character '}' looking for beginning of object key string", 10}},
+		{OLPC, "[\"\x01\"] 1", record{}, &SyntaxError{"invalid character '1' after top-level value", 7}},
+	} {
+		var got record
+		err := tt.profile.Unmarshal([]byte(tt.in), &got)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("%v.Unmarshal(%q): got error %#v, want %#v", tt.profile, tt.in, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v.Unmarshal(%q) = %#v, want %#v", tt.profile, tt.in, got, tt.want)
+		}
+	}
+}
@@ -17,15 +17,23 @@ package canonicaljson
 import (
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 )
 
 // checkValid verifies that data is valid JSON-encoded data.
 // scan is passed in for use by checkValid to avoid an allocation.
 func checkValid(data []byte, scan *scanner) error {
 	scan.reset()
-	for _, c := range data {
+	for i := 0; i < len(data); i++ {
+		if scan.run != runNone {
+			n := scan.continueRun(data[i:])
+			scan.bytes += int64(n)
+			if i += n; i == len(data) {
+				break
+			}
+		}
 		scan.bytes++
-		if scan.step(scan, c) == scanError {
+		if scan.step(scan, data[i]) == scanError {
 			return scan.err
 		}
 	}
@@ -40,8 +48,13 @@ func checkValid(data []byte, scan *scanner) error {
 // scan is passed in for use by nextValue to avoid an allocation.
 func nextValue(data []byte, scan *scanner) (value, rest []byte, err error) {
 	scan.reset()
-	for i, c := range data {
-		v := scan.step(scan, c)
+	for i := 0; i < len(data); i++ {
+		if scan.run != runNone {
+			if i += scan.continueRun(data[i:]); i == len(data) {
+				break
+			}
+		}
+		v := scan.step(scan, data[i])
 		if v >= scanEndObject {
 			switch v {
 			// probe the scanner with a space to determine whether we will
@@ -74,7 +87,8 @@ func (e *SyntaxError) Error() string { return e.msg }
 
 // A scanner is a JSON scanning state machine.
 // Callers call scan.reset() and then pass bytes in one at a time
-// by calling scan.step(&scan, c) for each byte.
+// by calling scan.step(&scan, c) for each byte,
+// except that they may skip any run of bytes reported by scan.continueRun.
 // The return value, referred to as an opcode, tells the
 // caller about significant parsing events like beginning
 // and ending literals, objects, and arrays, so that the
@@ -105,6 +119,12 @@ type scanner struct {
 	redoCode  int
 	redoState func(*scanner, byte) int
 
+	// Kind of run that step would consume byte by byte with scanContinue
+	// and no change of state, which callers can skip in bulk (see
+	// continueRun). It is maintained by the states that consume runs, and
+	// is runNone whenever step is some other state.
+	run int
+
 	// total bytes consumed, updated by decoder.Decode
 	bytes int64
 }
@@ -134,6 +154,13 @@ const (
 	scanError // hit an error, scanner.err.
 )
 
+// These values are stored in scanner.run.
+const (
+	runNone   = iota
+	runString // stateInString
+	runDigits // state1, stateDot0, or stateE0
+)
+
 // These values are stored in the parseState stack.
 // They give the current state of a composite value
 // being scanned. If the parser is inside a nested value
@@ -152,8 +179,52 @@ func (s *scanner) reset() {
 	s.err = nil
 	s.redo = false
 	s.endTop = false
+	s.run = runNone
+}
+
+// continueRun returns the length of the longest prefix of data that the
+// scanner would consume one byte at a time with scanContinue and no change
+// of state, i.e. a run of digits in a number or of characters in a string
+// other than quotation mark, reverse solidus, control characters, and
+// malformed (or incomplete) UTF-8. Callers may skip over it instead of
+// stepping through it.
+func (s *scanner) continueRun(data []byte) int {
+	i := 0
+	switch s.run {
+	case runString:
+		for i < len(data) {
+			if c := data[i]; c < utf8.RuneSelf {
+				if !plainStringByte[c] {
+					break
+				}
+				i++
+				continue
+			}
+			// utf8.DecodeRune accepts exactly the well-formed sequences
+			// accepted by the stateInStringContinuation states.
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				break
+			}
+			i += size
+		}
+	case runDigits:
+		for i < len(data) && '0' <= data[i] && data[i] <= '9' {
+			i++
+		}
+	}
+	return i
 }
 
+// plainStringByte reports whether an ASCII byte stands for itself in a
+// JSON string.
+var plainStringByte = func() (t [utf8.RuneSelf]bool) {
+	for c := ' '; c < utf8.RuneSelf; c++ {
+		t[c] = c != '"' && c != '\\'
+	}
+	return t
+}()
+
 // eof tells the scanner that the end of input has been reached.
 // It returns a scan status just as s.step does.
 func (s *scanner) eof() int {
@@ -223,6 +294,7 @@ func stateBeginValue(s *scanner, c byte) int {
 		return scanBeginArray
 	case '"':
 		s.step = stateInString
+		s.run = runString
 		return scanBeginLiteral
 	case '-':
 		s.step = stateNeg
@@ -242,6 +314,7 @@ func stateBeginValue(s *scanner, c byte) int {
 	}
 	if '1' <= c && c <= '9' { // beginning of 1234.5
 		s.step = state1
+		s.run = runDigits
 		return scanBeginLiteral
 	}
 	return s.error(c, "looking for beginning of value")
@@ -267,6 +340,7 @@ func stateBeginString(s *scanner, c byte) int {
 	}
 	if c == '"' {
 		s.step = stateInString
+		s.run = runString
 		return scanBeginLiteral
 	}
 	return s.error(c, "looking for beginning of object key string")
@@ -335,15 +409,18 @@ func stateEndTop(s *scanner, c byte) int {
 func stateInString(s *scanner, c byte) int {
 	if c == '"' {
 		s.step = stateEndValue
+		s.run = runNone
 		return scanContinue
 	}
 	if c == '\\' {
 		s.step = stateInStringEsc
+		s.run = runNone
 		return scanContinue
 	}
 	if c < 0x20 {
 		return s.error(c, "in string literal")
 	} else if c >= 0x80 {
+		s.run = runNone
 		// Require a well-formed UTF-8 sequence.
 		// See Table 3-7 in http://www.unicode.org/versions/Unicode10.0.0/ch03.pdf#G7404
 		if c >= 0xC2 && c <= 0xDF {
@@ -374,6 +451,7 @@ func stateInStringContinuation1(s *scanner, c byte) int {
 		return s.error(c, "in UTF-8 multi-byte sequence (expecting UTF-8 continuation byte)")
 	}
 	s.step = stateInString
+	s.run = runString
 	return scanContinue
 }
 
@@ -450,6 +528,7 @@ func stateInStringEsc(s *scanner, c byte) int {
 	switch c {
 	case 'b', 'f', 'n', 'r', 't', '\\', '/', '"':
 		s.step = stateInString
+		s.run = runString
 		return scanContinue
 	case 'u':
 		s.step = stateInStringEscU
@@ -492,6 +571,7 @@ func stateInStringEscU12(s *scanner, c byte) int {
 func stateInStringEscU123(s *scanner, c byte) int {
 	if '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' {
 		s.step = stateInString
+		s.run = runString
 		return scanContinue
 	}
 	// numbers
@@ -506,6 +586,7 @@ func stateNeg(s *scanner, c byte) int {
 	}
 	if '1' <= c && c <= '9' {
 		s.step = state1
+		s.run = runDigits
 		return scanContinue
 	}
 	return s.error(c, "in numeric literal")
@@ -518,6 +599,7 @@ func state1(s *scanner, c byte) int {
 		s.step = state1
 		return scanContinue
 	}
+	s.run = runNone
 	return state0(s, c)
 }
 
@@ -539,6 +621,7 @@ func state0(s *scanner, c byte) int {
 func stateDot(s *scanner, c byte) int {
 	if '0' <= c && c <= '9' {
 		s.step = stateDot0
+		s.run = runDigits
 		return scanContinue
 	}
 	return s.error(c, "after decimal point in numeric literal")
@@ -550,6 +633,7 @@ func stateDot0(s *scanner, c byte) int {
 	if '0' <= c && c <= '9' {
 		return scanContinue
 	}
+	s.run = runNone
 	if c == 'e' || c == 'E' {
 		s.step = stateE
 		return scanContinue
@@ -572,6 +656,7 @@ func stateE(s *scanner, c byte) int {
 func stateESign(s *scanner, c byte) int {
 	if '0' <= c && c <= '9' {
 		s.step = stateE0
+		s.run = runDigits
 		return scanContinue
 	}
 	return s.error(c, "in exponent of numeric literal")
@@ -584,6 +669,7 @@ func stateE0(s *scanner, c byte) int {
 	if '0' <= c && c <= '9' {
 		return scanContinue
 	}
+	s.run = runNone
 	return stateEndValue(s, c)
 }
 
@@ -686,6 +772,7 @@ func stateError(s *scanner, c byte) int {
 // error records an error and switches to the error state.
 func (s *scanner) error(c byte, context string) int {
 	s.step = stateError
+	s.run = runNone
 	s.err = &SyntaxError{"invalid character " + quoteChar(c) + " " + context, s.bytes}
 	return scanError
 }
@@ -709,6 +796,7 @@ func (s *scanner) undo(scanCode int) {
 	s.redoState = s.step
 	s.step = stateRedo
 	s.redo = true
+	s.run = runNone
 }
 
 // stateRedo helps implement the scanner's 1-byte undo.
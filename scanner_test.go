@@ -6,8 +6,15 @@
 package canonicaljson
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // Tests of simple examples.
@@ -118,3 +125,203 @@ func TestMarshalIndent(t *testing.T) {
 		}
 	}
 }
+
+// checkValidBytewise is checkValid without skipping runs (see
+// scanner.continueRun).
+func checkValidBytewise(data []byte) error {
+	var scan scanner
+	scan.reset()
+	for _, c := range data {
+		scan.bytes++
+		if scan.step(&scan, c) == scanError {
+			return scan.err
+		}
+	}
+	if scan.eof() == scanError {
+		return scan.err
+	}
+	return nil
+}
+
+var scannerRunSeeds = []string{
+	`"plain ASCII text"`,
+	`["caf\u00e9 \"quoted\"\n", "ü日本語😀", ""]`,
+	`{"n":[0,-12,3.25,1E10,6.02e+23,-0.5e-7,1234567890123456789]}`,
+	`{"a":{"b":[true,false,null,"x\\y"]},"c":"\ud83d\ude00"}`,
+}
+
+// scannerRunMutations are bytes substituted into scannerRunSeeds to
+// produce invalid input, particularly within runs.
+var scannerRunMutations = []byte{'"', '\\', '0', '.', 'e', ' ', ',', 'x', 0x01, 0x7F, 0x80, 0xA0, 0xC3, 0xE0, 0xED, 0xF0, 0xF4, 0xFF}
+
+// TestScannerRuns checks that skipping runs does not change what is valid
+// or how errors are reported, including when input arrives a byte at a time.
+func TestScannerRuns(t *testing.T) {
+	var inputs []string
+	for _, seed := range scannerRunSeeds {
+		for i := 0; i <= len(seed); i++ {
+			inputs = append(inputs, seed[:i])
+			if i == len(seed) {
+				break
+			}
+			for _, c := range scannerRunMutations {
+				inputs = append(inputs, seed[:i]+string([]byte{c})+seed[i+1:])
+			}
+		}
+	}
+
+	for _, in := range inputs {
+		var scan scanner
+		data := []byte(in)
+		want := checkValidBytewise(data)
+		if err := checkValid(data, &scan); !reflect.DeepEqual(err, want) {
+			t.Errorf("checkValid(%q) = %#v, want %#v", in, err, want)
+		}
+
+		value, _, err := nextValue(data, &scan)
+		if err == nil && checkValidBytewise(value) != nil || err != nil && want == nil {
+			t.Errorf("nextValue(%q) = %q, %v", in, value, err)
+		}
+
+		var whole, split RawMessage
+		wholeErr := NewDecoder(bytes.NewReader(data)).Decode(&whole)
+		splitErr := NewDecoder(iotest.OneByteReader(bytes.NewReader(data))).Decode(&split)
+		if !reflect.DeepEqual(splitErr, wholeErr) || !bytes.Equal(split, whole) {
+			t.Errorf("Decode(%q) a byte at a time = %q, %v; want %q, %v", in, split, splitErr, whole, wholeErr)
+		}
+	}
+}
+
+// benchCorpora returns generated documents resembling typical inputs:
+// API records dominated by short strings, prose with non-ASCII text and
+// escapes, and numeric telemetry.
+func benchCorpora() []struct {
+	name string
+	data []byte
+} {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"canonical", "json", "café", "naïve", "über", "東京", "данные", "tab\tstop", "\"quoted\"", "signature", "payload", "résumé"}
+	sentence := func(n int) string {
+		ws := make([]string, n)
+		for i := range ws {
+			ws[i] = words[r.Intn(len(words))]
+		}
+		return strings.Join(ws, " ")
+	}
+
+	records := make([]interface{}, 1000)
+	for i := range records {
+		records[i] = map[string]interface{}{
+			"id":      i,
+			"name":    sentence(2),
+			"email":   fmt.Sprintf("user%d@example.com", r.Intn(1e6)),
+			"tags":    []string{words[r.Intn(len(words))], words[r.Intn(len(words))]},
+			"active":  r.Intn(2) == 0,
+			"created": fmt.Sprintf("2016-%02d-%02dT%02d:%02d:00Z", r.Intn(12)+1, r.Intn(28)+1, r.Intn(24), r.Intn(60)),
+			"score":   r.Float64() * 100,
+		}
+	}
+	prose := make([]interface{}, 200)
+	for i := range prose {
+		prose[i] = map[string]interface{}{
+			"title": sentence(6),
+			"body":  sentence(150) + "\n\n" + sentence(150),
+		}
+	}
+	telemetry := make([]interface{}, 5000)
+	for i := range telemetry {
+		telemetry[i] = []interface{}{1456000000000 + int64(i)*1000, r.NormFloat64() * 1e3, r.Intn(1 << 20)}
+	}
+
+	corpora := []struct {
+		name string
+		data []byte
+	}{
+		{"records", nil},
+		{"prose", nil},
+		{"telemetry", nil},
+	}
+	for i, v := range []interface{}{records, prose, telemetry} {
+		data, err := Marshal(v)
+		if err != nil {
+			panic(err)
+		}
+		corpora[i].data = data
+	}
+	return corpora
+}
+
+func BenchmarkCheckValid(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			var scan scanner
+			for i := 0; i < b.N; i++ {
+				if err := checkValid(c.data, &scan); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCheckValidBytewise validates without skipping runs, for
+// comparison.
+func BenchmarkCheckValidBytewise(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			for i := 0; i < b.N; i++ {
+				if err := checkValidBytewise(c.data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnmarshalGeneric(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var v interface{}
+				if err := Unmarshal(c.data, &v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecoderRaw(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			r := bytes.NewReader(c.data)
+			for i := 0; i < b.N; i++ {
+				r.Seek(0, io.SeekStart)
+				var raw RawMessage
+				if err := NewDecoder(r).Decode(&raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkIndent(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := addIndentation(&buf, c.data, "", "\t"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// SortedArray is a JSON array whose elements are sorted by their canonical
+// encodings, so that it encodes identically regardless of the order in
+// which they were added. It is the counterpart of the "set" struct field
+// option (see Marshal) for use in maps and interface values.
+type SortedArray []interface{}
+
+// AppendCanonicalJSON implements AppendMarshaler.
+func (a SortedArray) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	return appendEncoding(dst, sortedArrayEncoder, reflect.ValueOf(a), false)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a SortedArray) MarshalJSON() ([]byte, error) {
+	return a.AppendCanonicalJSON(nil)
+}
+
+var sortedArrayEncoder = (&setEncoder{elemEnc: interfaceEncoder}).encode
+
+// A DuplicateElementError is returned by Marshal for a slice or array with
+// the "set" and "unique" options (see Marshal) having elements with the
+// same encoding.
+type DuplicateElementError struct {
+	Type     reflect.Type // type of the slice or array
+	Index    int          // index of the duplicate element
+	First    int          // index of the earlier element it duplicates
+	Encoding string       // encoding of the elements, truncated if long
+}
+
+func (e *DuplicateElementError) Error() string {
+	return "canonicaljson: element " + strconv.Itoa(e.Index) + " of " + e.Type.String() +
+		" duplicates element " + strconv.Itoa(e.First) + ": " + e.Encoding
+}
+
+// maxErrorEncoding is the length beyond which an encoding is truncated in
+// an error.
+const maxErrorEncoding = 64
+
+// truncateEncoding returns b as a string, truncated to about
+// maxErrorEncoding bytes (on a UTF-8 boundary).
+func truncateEncoding(b []byte) string {
+	if len(b) <= maxErrorEncoding {
+		return string(b)
+	}
+	n := maxErrorEncoding
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return string(b[:n]) + "..."
+}
+
+// setEncoder encodes a slice or array as a JSON array with its elements
+// sorted by their encodings.
+type setEncoder struct {
+	elemEnc encoderFunc
+	unique  bool // whether to reject duplicate elements
+}
+
+// A setElem is the encoding of the element of a set at index.
+type setElem struct {
+	enc   []byte
+	index int
+}
+
+func (se *setEncoder) encode(e *encodeState, v reflect.Value, _ bool) {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+
+	// Encode each element in place, then move it aside. Equal encodings
+	// stay in index order, so that a duplicate follows its first instance.
+	n := v.Len()
+	elems := make([]setElem, n)
+	start := e.Len()
+	for i := 0; i < n; i++ {
+		se.elemEnc(e, v.Index(i), false)
+		elems[i] = setElem{append([]byte(nil), e.Bytes()[start:]...), i}
+		e.Truncate(start)
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		c := bytes.Compare(elems[i].enc, elems[j].enc)
+		return c < 0 || c == 0 && elems[i].index < elems[j].index
+	})
+
+	e.WriteByte('[')
+	for i, elem := range elems {
+		if i > 0 {
+			if prev := elems[i-1]; se.unique && bytes.Equal(elem.enc, prev.enc) {
+				e.error(&DuplicateElementError{v.Type(), elem.index, prev.index, truncateEncoding(elem.enc)})
+			}
+			e.WriteByte(',')
+		}
+		e.Write(elem.enc)
+	}
+	e.WriteByte(']')
+}
+
+// newSetEncoder returns an encoder for a slice or array type t with the
+// "set" option, unless t has its own marshaling methods or is a byte slice
+// (which encodes as a string).
+func newSetEncoder(t reflect.Type, unique bool) encoderFunc {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return typeEncoder(t)
+	}
+	for _, iface := range []reflect.Type{appendMarshalerType, canonicalMarshalerType, marshalerType, textMarshalerType} {
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			return typeEncoder(t)
+		}
+	}
+	se := &setEncoder{typeEncoder(t.Elem()), unique}
+	return se.encode
+}
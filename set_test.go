@@ -0,0 +1,99 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+type setTagged struct {
+	Roles   []string      `json:"roles,set"`
+	Unique  []string      `json:"unique,omitempty,set,unique"`
+	Nums    [3]float64    `json:"nums,set"`
+	Objects []interface{} `json:"objects,set"`
+	Bytes   []byte        `json:"bytes,set"`
+	Ordered []int         `json:"ordered"`
+	Custom  customList    `json:"custom,set"`
+}
+
+// customList has its own encoding, which the "set" option does not change.
+type customList []string
+
+func (customList) MarshalJSON() ([]byte, error) {
+	return []byte(`"custom"`), nil
+}
+
+func TestSetOption(t *testing.T) {
+	v := setTagged{
+		Roles:   []string{"write", "admin", "read", "admin"},
+		Unique:  []string{"b", "a"},
+		Nums:    [3]float64{10, 9, -1.5},
+		Objects: []interface{}{map[string]interface{}{"b": 1}, "x", nil, map[string]interface{}{"a": 2}, true},
+		Bytes:   []byte("ba"),
+		Ordered: []int{3, 1, 2},
+	}
+	want := `{"bytes":"YmE=","custom":"custom","nums":[-1.5E0,10,9],` +
+		`"objects":["x",null,true,{"a":2},{"b":1}],"ordered":[3,1,2],` +
+		`"roles":["admin","admin","read","write"],"unique":["a","b"]}`
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Marshal:\n got: %s\nwant: %s", got, want)
+	}
+
+	v = setTagged{}
+	want = `{"bytes":null,"custom":"custom","nums":[0,0,0],"objects":null,"ordered":null,"roles":null}`
+	if got, err := Marshal(v); err != nil {
+		t.Error(err)
+	} else if string(got) != want {
+		t.Errorf("Marshal:\n got: %s\nwant: %s", got, want)
+	}
+
+	v.Unique = []string{"a", "b", "a"}
+	_, err = Marshal(v)
+	want = "canonicaljson: element 2 of []string duplicates element 0: \"a\""
+	if derr, ok := err.(*DuplicateElementError); !ok || derr.Index != 2 || derr.First != 0 {
+		t.Errorf("Marshal with duplicate unique set elements: got error %#v, want *DuplicateElementError", err)
+	} else if err.Error() != want {
+		t.Errorf("Marshal with duplicate unique set elements: got error %q, want %q", err, want)
+	}
+
+	// A byte slice is never a set, even if its encoder is requested.
+	b, err := appendEncoding(nil, newSetEncoder(reflect.TypeOf([]byte(nil)), true), reflect.ValueOf([]byte("aa")), false)
+	if err != nil || string(b) != `"YWE="` {
+		t.Errorf("set encoding of []byte = %s, %v; want base64", b, err)
+	}
+
+	// Long encodings are truncated in the error.
+	long := strings.Repeat("é", 100)
+	v.Unique = []string{"a", long, long}
+	_, err = Marshal(v)
+	if derr, ok := err.(*DuplicateElementError); !ok || derr.Index != 2 || derr.First != 1 {
+		t.Errorf("Marshal with long duplicate elements: got error %#v, want *DuplicateElementError", err)
+	} else if n := len(derr.Encoding); n > maxErrorEncoding+len("...") || !utf8.ValidString(derr.Encoding) {
+		t.Errorf("Marshal with long duplicate elements: got encoding %q", derr.Encoding)
+	}
+}
+
+func TestSortedArray(t *testing.T) {
+	v := map[string]interface{}{
+		"set":   SortedArray{"b", 1.5, "a", SortedArray{2, 1}, []int{2, 1}},
+		"empty": SortedArray{},
+		"nil":   SortedArray(nil),
+	}
+	want := `{"empty":[],"nil":null,"set":["a","b",1.5E0,[1,2],[2,1]]}`
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Marshal:\n got: %s\nwant: %s", got, want)
+	}
+}
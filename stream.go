@@ -9,19 +9,30 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"reflect"
+	"strconv"
 )
 
 // A Decoder reads and decodes JSON objects from an input stream.
 type Decoder struct {
-	r     io.Reader
-	buf   []byte
-	d     decodeState
-	scanp int // start of unread data in buf
-	scan  scanner
-	err   error
+	r       io.Reader
+	buf     []byte
+	d       decodeState
+	scanp   int   // start of unread data in buf
+	scanned int64 // amount of data already scanned
+	scan    scanner
+	err     error
 
 	tokenState int
-	tokenStack []int
+	tokenStack []tokenFrame
+}
+
+// A tokenFrame describes an array or object that the Token API is in.
+type tokenFrame struct {
+	state  int    // tokenState to restore at its end
+	kind   Delim  // '[' or '{'
+	length int    // number of elements or members so far
+	key    []byte // encoded name of the current member of an object
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -32,10 +43,50 @@ func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{r: r}
 }
 
+// Reset discards the state of the Decoder, except for options such as
+// UseNumber, so that it reads from r as if newly created, reusing its
+// buffer.
+func (dec *Decoder) Reset(r io.Reader) {
+	dec.r = r
+	dec.buf = dec.buf[:0]
+	dec.scanp = 0
+	dec.scanned = 0
+	dec.scan = scanner{parseState: dec.scan.parseState[:0]}
+	dec.err = nil
+	dec.tokenState = tokenTopValue
+	dec.tokenStack = dec.tokenStack[:0]
+}
+
 // UseNumber causes the Decoder to unmarshal a number into an interface{} as a
 // Number instead of as a float64.
 func (dec *Decoder) UseNumber() { dec.d.useNumber = true }
 
+// ExactNumbers causes the Decoder to return a PrecisionError (after
+// decoding the rest of the value) when it decodes a number into a
+// floating point value that does not represent it exactly, i.e. whose
+// canonical encoding differs from that of the number. For example, both
+// 9007199254740993 and 0.1000000000000000055511151231257827 are rounded
+// when decoded into a float64 and cause an error, but 0.1 does not. This
+// applies to the fields of types generated by canonicaljson-gen (see
+// FieldsUnmarshaler), but not within other types that implement Unmarshaler
+// or CanonicalUnmarshaler.
+func (dec *Decoder) ExactNumbers() { dec.d.exactNumbers = true }
+
+// ExactFieldNames causes the Decoder to match object keys to struct fields
+// by exact name only, rather than also accepting a case-insensitive match,
+// so that e.g. {"Amount":1,"amount":2} cannot set the same field twice.
+// Keys that match a field only case-insensitively are ignored, or if strict
+// is true, cause Decode to return a FieldCaseError (after decoding the
+// rest of the value). Structs with an "inline" field always match exact
+// names only, and store such keys in that field instead (see Unmarshal).
+// Types generated by canonicaljson-gen (see FieldsUnmarshaler) are matched
+// the same way, but other types that implement Unmarshaler or
+// CanonicalUnmarshaler are unaffected and decode as Unmarshal does.
+func (dec *Decoder) ExactFieldNames(strict bool) {
+	dec.d.exactNames = true
+	dec.d.strictNames = strict
+}
+
 // Decode reads the next JSON-encoded value from its
 // input and stores it in the value pointed to by v.
 //
@@ -53,6 +104,7 @@ func (dec *Decoder) Decode(v interface{}) error {
 	if !dec.tokenValueAllowed() {
 		return &SyntaxError{msg: "not at beginning of value"}
 	}
+	dec.tokenValueStart()
 
 	// Read whole value into buffer.
 	n, err := dec.readValue()
@@ -89,9 +141,17 @@ func (dec *Decoder) readValue() (int, error) {
 Input:
 	for {
 		// Look in the buffer for a new value.
-		for i, c := range dec.buf[scanp:] {
+		buf := dec.buf[scanp:]
+		for i := 0; i < len(buf); i++ {
+			if dec.scan.run != runNone {
+				n := dec.scan.continueRun(buf[i:])
+				dec.scan.bytes += int64(n)
+				if i += n; i == len(buf) {
+					break
+				}
+			}
 			dec.scan.bytes++
-			v := dec.scan.step(&dec.scan, c)
+			v := dec.scan.step(&dec.scan, buf[i])
 			if v == scanEnd {
 				scanp += i
 				break Input
@@ -132,10 +192,60 @@ Input:
 	return scanp - dec.scanp, nil
 }
 
+// readLiteral reads the string, number, or literal name at the start of
+// the unread data, which is in an array or object with parse state ps,
+// and returns its length. Unlike readValue, it accepts any punctuation
+// that can follow it there (without allocating an error for it).
+func (dec *Decoder) readLiteral(ps int) (int, error) {
+	if dec.err != nil {
+		return 0, dec.err
+	}
+	dec.scan.reset()
+	dec.scan.pushParseState(ps)
+
+	scanp := dec.scanp
+	var err error
+	for {
+		buf := dec.buf[scanp:]
+		for i := 0; i < len(buf); i++ {
+			if dec.scan.run != runNone {
+				n := dec.scan.continueRun(buf[i:])
+				dec.scan.bytes += int64(n)
+				if i += n; i == len(buf) {
+					break
+				}
+			}
+			dec.scan.bytes++
+			v := dec.scan.step(&dec.scan, buf[i])
+			if v == scanError {
+				dec.err = dec.scan.err
+				return 0, dec.scan.err
+			}
+			if v != scanContinue && scanp+i > dec.scanp {
+				return scanp + i - dec.scanp, nil
+			}
+		}
+		scanp = len(dec.buf)
+
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			dec.err = err
+			return 0, err
+		}
+
+		n := scanp - dec.scanp
+		err = dec.refill()
+		scanp = dec.scanp + n
+	}
+}
+
 func (dec *Decoder) refill() error {
 	// Make room to read more into the buffer.
 	// First slide down data already consumed.
 	if dec.scanp > 0 {
+		dec.scanned += int64(dec.scanp)
 		n := copy(dec.buf, dec.buf[dec.scanp:])
 		dec.buf = dec.buf[:n]
 		dec.scanp = 0
@@ -169,6 +279,9 @@ func nonSpace(b []byte) bool {
 type Encoder struct {
 	w   io.Writer
 	err error
+
+	parallelism int
+	verify      bool
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -186,6 +299,8 @@ func (enc *Encoder) Encode(v interface{}) error {
 		return enc.err
 	}
 	e := newEncodeState()
+	e.parallelism = enc.parallelism
+	e.verify = enc.verify
 	err := e.marshal(v)
 	if err != nil {
 		return err
@@ -206,6 +321,25 @@ func (enc *Encoder) Encode(v interface{}) error {
 	return err
 }
 
+// SetParallelism causes the Encoder to encode the elements of large arrays
+// (and slices) and the members of large maps using up to n goroutines,
+// which is disabled when n is less than 2 (the default). The output is
+// identical to that of serial encoding, but methods such as MarshalJSON
+// may be called concurrently for the elements of a single array or map.
+func (enc *Encoder) SetParallelism(n int) {
+	enc.parallelism = n
+}
+
+// SetVerifyMarshalers specifies whether the Encoder checks the output of
+// AppendMarshaler and CanonicalMarshaler methods, which is otherwise
+// trusted. When verify is true, output that is not in canonical form (see
+// CheckCanonical) causes Encode to return a MarshalerError. It is intended
+// for use in tests and while debugging. Output appended by a method that
+// itself calls AppendMarshal is checked only as a whole.
+func (enc *Encoder) SetVerifyMarshalers(verify bool) {
+	enc.verify = verify
+}
+
 // RawMessage is a raw encoded JSON object.
 // It implements Marshaler and Unmarshaler and can
 // be used to delay JSON decoding or precompute a JSON encoding.
@@ -289,6 +423,13 @@ func (dec *Decoder) tokenValueAllowed() bool {
 	return false
 }
 
+// tokenValueStart counts a value beginning as an array element.
+func (dec *Decoder) tokenValueStart() {
+	if n := len(dec.tokenStack); n > 0 && (dec.tokenState == tokenArrayStart || dec.tokenState == tokenArrayValue) {
+		dec.tokenStack[n-1].length++
+	}
+}
+
 func (dec *Decoder) tokenValueEnd() {
 	switch dec.tokenState {
 	case tokenArrayStart, tokenArrayValue:
@@ -323,77 +464,25 @@ func (dec *Decoder) Token() (Token, error) {
 			return nil, err
 		}
 		switch c {
-		case '[':
-			if !dec.tokenValueAllowed() {
-				return dec.tokenError(c)
-			}
-			dec.scanp++
-			dec.tokenStack = append(dec.tokenStack, dec.tokenState)
-			dec.tokenState = tokenArrayStart
-			return Delim('['), nil
-
-		case ']':
-			if dec.tokenState != tokenArrayStart && dec.tokenState != tokenArrayComma {
-				return dec.tokenError(c)
-			}
-			dec.scanp++
-			dec.tokenState = dec.tokenStack[len(dec.tokenStack)-1]
-			dec.tokenStack = dec.tokenStack[:len(dec.tokenStack)-1]
-			dec.tokenValueEnd()
-			return Delim(']'), nil
-
-		case '{':
-			if !dec.tokenValueAllowed() {
-				return dec.tokenError(c)
+		case '[', ']', '{', '}':
+			if err := dec.tokenDelim(c); err != nil {
+				return nil, err
 			}
-			dec.scanp++
-			dec.tokenStack = append(dec.tokenStack, dec.tokenState)
-			dec.tokenState = tokenObjectStart
-			return Delim('{'), nil
+			return Delim(c), nil
 
-		case '}':
-			if dec.tokenState != tokenObjectStart && dec.tokenState != tokenObjectComma {
-				return dec.tokenError(c)
-			}
-			dec.scanp++
-			dec.tokenState = dec.tokenStack[len(dec.tokenStack)-1]
-			dec.tokenStack = dec.tokenStack[:len(dec.tokenStack)-1]
-			dec.tokenValueEnd()
-			return Delim('}'), nil
-
-		case ':':
-			if dec.tokenState != tokenObjectColon {
-				return dec.tokenError(c)
+		case ':', ',':
+			if err := dec.tokenSeparator(c); err != nil {
+				return nil, err
 			}
-			dec.scanp++
-			dec.tokenState = tokenObjectValue
 			continue
 
-		case ',':
-			if dec.tokenState == tokenArrayComma {
-				dec.scanp++
-				dec.tokenState = tokenArrayValue
-				continue
-			}
-			if dec.tokenState == tokenObjectComma {
-				dec.scanp++
-				dec.tokenState = tokenObjectKey
-				continue
-			}
-			return dec.tokenError(c)
-
 		case '"':
 			if dec.tokenState == tokenObjectStart || dec.tokenState == tokenObjectKey {
-				var x string
-				old := dec.tokenState
-				dec.tokenState = tokenTopValue
-				err := dec.Decode(&x)
-				dec.tokenState = old
+				key, err := dec.readKey()
 				if err != nil {
-					clearOffset(err)
 					return nil, err
 				}
-				dec.tokenState = tokenObjectColon
+				x, _ := unquote(key)
 				return x, nil
 			}
 			fallthrough
@@ -412,6 +501,160 @@ func (dec *Decoder) Token() (Token, error) {
 	}
 }
 
+// A Kind is the kind of a JSON token, identified by its first byte:
+// 'n' for null, 'f' for false, 't' for true, '"' for a string, '0' for
+// a number, or the delimiter itself.
+type Kind byte
+
+func (k Kind) String() string {
+	switch k {
+	case 'n':
+		return "null"
+	case 'f':
+		return "false"
+	case 't':
+		return "true"
+	case '"':
+		return "string"
+	case '0':
+		return "number"
+	case '[', ']', '{', '}':
+		return string(k)
+	}
+	return "invalid"
+}
+
+// ReadToken is a lower-level alternative to Token that returns the kind of
+// the next JSON token in the input stream and its encoding (as it appears
+// in the input, e.g. a string with its quotation marks and any escape
+// sequences), without decoding it or allocating memory. The encoding is
+// valid only until the next call to a method of the Decoder. Object keys
+// are strings, distinguished by their position (see StackIndex).
+// ReadToken and Token can be used together.
+func (dec *Decoder) ReadToken() (Kind, []byte, error) {
+	for {
+		c, err := dec.peek()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch c {
+		case '[', ']', '{', '}':
+			if err := dec.tokenDelim(c); err != nil {
+				return 0, nil, err
+			}
+			return Kind(c), dec.buf[dec.scanp-1 : dec.scanp], nil
+
+		case ':', ',':
+			if err := dec.tokenSeparator(c); err != nil {
+				return 0, nil, err
+			}
+			continue
+
+		case '"':
+			if dec.tokenState == tokenObjectStart || dec.tokenState == tokenObjectKey {
+				key, err := dec.readKey()
+				if err != nil {
+					return 0, nil, err
+				}
+				return '"', key, nil
+			}
+		}
+
+		var n int
+		switch dec.tokenState {
+		case tokenTopValue:
+			n, err = dec.readValue()
+		case tokenArrayStart, tokenArrayValue:
+			n, err = dec.readLiteral(parseArrayValue)
+		case tokenObjectValue:
+			n, err = dec.readLiteral(parseObjectValue)
+		default:
+			_, err = dec.tokenError(c)
+			return 0, nil, err
+		}
+		if err != nil {
+			clearOffset(err)
+			return 0, nil, err
+		}
+		dec.tokenValueStart()
+		value := dec.buf[dec.scanp : dec.scanp+n]
+		dec.scanp += n
+		dec.tokenValueEnd()
+		if c == '-' || '0' <= c && c <= '9' {
+			c = '0'
+		}
+		return Kind(c), value, nil
+	}
+}
+
+// tokenDelim consumes the delimiter c, which is next in the input.
+func (dec *Decoder) tokenDelim(c byte) error {
+	switch c {
+	case '[', '{':
+		if !dec.tokenValueAllowed() {
+			_, err := dec.tokenError(c)
+			return err
+		}
+		dec.scanp++
+		dec.tokenValueStart()
+		// Reuse the key buffer of any previous frame at this depth.
+		var key []byte
+		if n := len(dec.tokenStack); n < cap(dec.tokenStack) {
+			key = dec.tokenStack[:n+1][n].key[:0]
+		}
+		dec.tokenStack = append(dec.tokenStack, tokenFrame{state: dec.tokenState, kind: Delim(c), key: key})
+		dec.tokenState = tokenArrayStart
+		if c == '{' {
+			dec.tokenState = tokenObjectStart
+		}
+	default:
+		if c == ']' && dec.tokenState != tokenArrayStart && dec.tokenState != tokenArrayComma ||
+			c == '}' && dec.tokenState != tokenObjectStart && dec.tokenState != tokenObjectComma {
+			_, err := dec.tokenError(c)
+			return err
+		}
+		dec.scanp++
+		dec.tokenState = dec.tokenStack[len(dec.tokenStack)-1].state
+		dec.tokenStack = dec.tokenStack[:len(dec.tokenStack)-1]
+		dec.tokenValueEnd()
+	}
+	return nil
+}
+
+// tokenSeparator consumes the colon or comma c, which is next in the input.
+func (dec *Decoder) tokenSeparator(c byte) error {
+	switch {
+	case c == ':' && dec.tokenState == tokenObjectColon:
+		dec.tokenState = tokenObjectValue
+	case c == ',' && dec.tokenState == tokenArrayComma:
+		dec.tokenState = tokenArrayValue
+	case c == ',' && dec.tokenState == tokenObjectComma:
+		dec.tokenState = tokenObjectKey
+	default:
+		_, err := dec.tokenError(c)
+		return err
+	}
+	dec.scanp++
+	return nil
+}
+
+// readKey consumes the object key that is next in the input, returning
+// its encoding.
+func (dec *Decoder) readKey() ([]byte, error) {
+	n, err := dec.readLiteral(parseObjectKey)
+	if err != nil {
+		clearOffset(err)
+		return nil, err
+	}
+	key := dec.buf[dec.scanp : dec.scanp+n]
+	dec.scanp += n
+	dec.tokenState = tokenObjectColon
+	frame := &dec.tokenStack[len(dec.tokenStack)-1]
+	frame.length++
+	frame.key = append(frame.key[:0], key...)
+	return key, nil
+}
+
 func clearOffset(err error) {
 	if s, ok := err.(*SyntaxError); ok {
 		s.Offset = 0
@@ -437,6 +680,33 @@ func (dec *Decoder) tokenError(c byte) (Token, error) {
 	return nil, &SyntaxError{"invalid character " + quoteChar(c) + " " + context, 0}
 }
 
+// InputOffset returns the offset in the input stream of the current
+// position of the Decoder, which is the end of the most recently returned
+// token or value and the beginning of the next.
+func (dec *Decoder) InputOffset() int64 {
+	return dec.scanned + int64(dec.scanp)
+}
+
+// StackDepth returns the number of arrays and objects that the Decoder is
+// in, having read their opening delimiters with Token but not their
+// closing delimiters.
+func (dec *Decoder) StackDepth() int {
+	return len(dec.tokenStack)
+}
+
+// StackIndex describes the ith array or object that the Decoder is in,
+// where i is in [0, StackDepth()) and 0 is the outermost. It returns its
+// opening delimiter, the number of elements or members begun so far
+// (so that the current element of an array has index length-1), and for
+// an object, the name of the current member (or "" if there is none).
+func (dec *Decoder) StackIndex(i int) (kind Delim, length int, key string) {
+	frame := dec.tokenStack[i]
+	if len(frame.key) > 0 {
+		key, _ = unquote(frame.key)
+	}
+	return frame.kind, frame.length, key
+}
+
 // More reports whether there is another element in the
 // current array or object being parsed.
 func (dec *Decoder) More() bool {
@@ -444,6 +714,109 @@ func (dec *Decoder) More() bool {
 	return err == nil && c != ']' && c != '}'
 }
 
+// Descend advances through nested JSON objects of the input stream,
+// following path as a sequence of member names, and stops before the
+// value of the final member. Members not on the path are skipped without
+// being read into memory whole. Combined with Token, More, and Decode,
+// this allows decoding the elements of a large array one at a time:
+//
+//	if err := dec.Descend("data", "records"); err != nil { ... }
+//	if _, err := dec.Token(); err != nil { ... } // [
+//	for dec.More() {
+//		var r Record
+//		if err := dec.Decode(&r); err != nil { ... }
+//	}
+//
+// The enclosing objects remain open, and their remaining members can be
+// read with Token.
+func (dec *Decoder) Descend(path ...string) error {
+	for _, name := range path {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != Delim('{') {
+			return &UnmarshalTypeError{tokenKind(tok), reflect.TypeOf(map[string]interface{}(nil)), 0}
+		}
+		for {
+			if !dec.More() {
+				return errors.New("canonicaljson: object member " + strconv.Quote(name) + " not found")
+			}
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if key == name {
+				break
+			}
+			if err := dec.SkipValue(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SkipValue consumes the next JSON value of the input stream, or if the
+// next token is an object key, the object member that it begins. Unlike
+// Decode, it reads only one token into memory at a time, and unlike Token,
+// it does not decode them.
+func (dec *Decoder) SkipValue() error {
+	c, err := dec.peek()
+	if err == io.EOF && dec.tokenState != tokenTopValue {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if c == ']' || c == '}' {
+		_, err := dec.tokenError(c)
+		return err
+	}
+	depth := 0
+	for {
+		kind, _, err := dec.ReadToken()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch kind {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '"':
+			if dec.tokenState == tokenObjectColon {
+				// Also skip the value of this member.
+				continue
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// tokenKind describes the JSON value beginning with tok.
+func tokenKind(tok Token) string {
+	switch tok.(type) {
+	case Delim:
+		if tok == Delim('[') {
+			return "array"
+		}
+		return "object"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case nil:
+		return "null"
+	}
+	return "number"
+}
+
 func (dec *Decoder) peek() (byte, error) {
 	var err error
 	for {
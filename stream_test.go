@@ -8,8 +8,13 @@ package canonicaljson
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // Test values for the stream test.
@@ -131,6 +136,202 @@ func BenchmarkEncoderEncode(b *testing.B) {
 	}
 }
 
+// snapshotRecord is a typical element of a large exported collection.
+type snapshotRecord struct {
+	ID    int               `json:"id"`
+	Name  string            `json:"name"`
+	Score float64           `json:"score"`
+	Tags  []string          `json:"tags,omitempty"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+// snapshot returns a value with large slices and maps (including a large
+// map nested in a small slice) to encode in parallel.
+func snapshot(n int) interface{} {
+	records := make([]snapshotRecord, n)
+	index := make(map[string]interface{}, n)
+	for i := range records {
+		records[i] = snapshotRecord{
+			ID:    i,
+			Name:  fmt.Sprintf("record %d", i),
+			Score: float64(i) / 7,
+			Attrs: map[string]string{"b": "x", "a": strings.Repeat("y", i%5)},
+		}
+		if i%3 == 0 {
+			records[i].Tags = []string{"t", fmt.Sprint(i % 11)}
+		}
+		index[fmt.Sprint(i*7919%n)] = []int{i, -i}
+	}
+	return map[string]interface{}{
+		"records": records,
+		"index":   []interface{}{index},
+		"small":   []int{3, 2, 1},
+	}
+}
+
+// failAt fails to marshal when its value is positive.
+type failAt int
+
+func (f failAt) MarshalJSON() ([]byte, error) {
+	if f > 0 {
+		return nil, fmt.Errorf("element %d", f)
+	}
+	return []byte("0"), nil
+}
+
+func TestEncoderParallelism(t *testing.T) {
+	v := snapshot(5000)
+	want, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, 2, 3, 8} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetParallelism(n)
+		if err := enc.Encode(v); err != nil {
+			t.Errorf("SetParallelism(%d): Encode: %v", n, err)
+		} else if got := bytes.TrimSuffix(buf.Bytes(), []byte("\n")); !bytes.Equal(got, want) {
+			t.Errorf("SetParallelism(%d): Encode output differs from Marshal", n)
+		}
+	}
+
+	// The first failure is reported, as it is when encoding serially.
+	failures := make([]failAt, 3000)
+	failures[2500], failures[1700], failures[1200] = 2500, 1700, 1200
+	enc := NewEncoder(ioutil.Discard)
+	enc.SetParallelism(4)
+	err = enc.Encode(failures)
+	if me, ok := err.(*MarshalerError); !ok || me.Err.Error() != "element 1200" {
+		t.Errorf("Encode with failing elements: got error %v, want element 1200", err)
+	}
+}
+
+func BenchmarkEncoderParallelism(b *testing.B) {
+	v := snapshot(50000)
+	for _, n := range []int{1, 4} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			enc := NewEncoder(ioutil.Discard)
+			enc.SetParallelism(n)
+			for i := 0; i < b.N; i++ {
+				if err := enc.Encode(v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`[1, 2] {"unfinished": [`))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Token{Delim('{'), "unfinished", Delim('[')} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Fatalf("Token() = %v, %v; want %v", tok, err, want)
+		}
+	}
+	buf := dec.buf[:1]
+
+	dec.Reset(strings.NewReader(` {"n": 1.5}`))
+	if dec.StackDepth() != 0 || dec.InputOffset() != 0 {
+		t.Errorf("after Reset: StackDepth() = %d, InputOffset() = %d; want 0, 0", dec.StackDepth(), dec.InputOffset())
+	}
+	v = nil
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"n": Number("1.5")}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Decode after Reset = %#v, want %#v", v, want)
+	}
+	if &dec.buf[:1][0] != &buf[0] {
+		t.Error("Reset did not reuse the buffer")
+	}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("Decode at end of input after Reset: got error %v, want io.EOF", err)
+	}
+
+	// Errors are forgotten.
+	dec.Reset(strings.NewReader(`[`))
+	if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Decode: got error %v, want io.ErrUnexpectedEOF", err)
+	}
+	dec.Reset(strings.NewReader(`true`))
+	if err := dec.Decode(&v); err != nil || v != true {
+		t.Errorf("Decode after Reset = %v, %v; want true", v, err)
+	}
+}
+
+// tokenFrameString describes the stack of a Decoder, as e.g. `{2:"a"[1`.
+func tokenFrameString(dec *Decoder) string {
+	var b bytes.Buffer
+	for i := 0; i < dec.StackDepth(); i++ {
+		kind, length, key := dec.StackIndex(i)
+		fmt.Fprintf(&b, "%v%d", kind, length)
+		if kind == Delim('{') {
+			fmt.Fprintf(&b, ":%q", key)
+		}
+	}
+	return b.String()
+}
+
+func TestDecoderPosition(t *testing.T) {
+	const in = ` {"a": [1, {"b": null}, [] ], "c" : "x"} 7`
+	want := []struct {
+		tok    Token
+		offset int64
+		stack  string
+	}{
+		{Delim('{'), 2, `{0:""`},
+		{"a", 5, `{1:"a"`},
+		{Delim('['), 8, `{1:"a"[0`},
+		{float64(1), 9, `{1:"a"[1`},
+		{Delim('{'), 12, `{1:"a"[2{0:""`},
+		{"b", 15, `{1:"a"[2{1:"b"`},
+		{nil, 21, `{1:"a"[2{1:"b"`},
+		{Delim('}'), 22, `{1:"a"[2`},
+		{Delim('['), 25, `{1:"a"[3[0`},
+		{Delim(']'), 26, `{1:"a"[3`},
+		{Delim(']'), 28, `{1:"a"`},
+		{"c", 33, `{2:"c"`},
+		{"x", 39, `{2:"c"`},
+		{Delim('}'), 40, ``},
+		{float64(7), 42, ``},
+	}
+	for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+		dec := NewDecoder(r)
+		for _, w := range want {
+			tok, err := dec.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok != w.tok || dec.InputOffset() != w.offset || tokenFrameString(dec) != w.stack {
+				t.Errorf("Token() = %v at %d in %s; want %v at %d in %s", tok, dec.InputOffset(), tokenFrameString(dec), w.tok, w.offset, w.stack)
+			}
+		}
+	}
+
+	// Decode counts array elements too.
+	dec := NewDecoder(strings.NewReader(`[{"x": 1}, {"x": 2}]`))
+	dec.Token()
+	for i := 1; dec.More(); i++ {
+		var v struct{ X int }
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := tokenFrameString(dec), fmt.Sprintf("[%d", i); got != want {
+			t.Errorf("after Decode, stack is %s; want %s", got, want)
+		}
+	}
+	if got := dec.InputOffset(); got != 19 {
+		t.Errorf("InputOffset() = %d, want 19", got)
+	}
+}
+
 type tokenStreamCase struct {
 	json      string
 	expTokens []interface{}
@@ -204,6 +405,331 @@ var tokenStreamCases []tokenStreamCase = []tokenStreamCase{
 	}},
 }
 
+// recordStream generates {"meta":…,"records":[{"ID":0},{"ID":1},…],"total":n}
+// without holding the whole document in memory.
+type recordStream struct {
+	n, next int
+	pending []byte
+}
+
+func (r *recordStream) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		switch {
+		case r.next < 0:
+			return 0, io.EOF
+		case r.next == 0:
+			r.pending = []byte(`{"meta": {"skip": [1, {"records": []}, "x"]}, "records": [`)
+		case r.next <= r.n:
+			r.pending = []byte(fmt.Sprintf(`{"ID": %d}`, r.next-1))
+			if r.next < r.n {
+				r.pending = append(r.pending, ',')
+			}
+		default:
+			r.pending = []byte(fmt.Sprintf(`], "total": %d}`, r.n))
+			r.next = -2
+		}
+		r.next++
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestDescend(t *testing.T) {
+	const n = 100000
+	dec := NewDecoder(&recordStream{n: n})
+	if err := dec.Descend("records"); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := dec.Token(); err != nil || tok != Delim('[') {
+		t.Fatalf("Token = %v, %v; want [", tok, err)
+	}
+	i := 0
+	for ; dec.More(); i++ {
+		var r struct{ ID int }
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != i {
+			t.Fatalf("record %d has ID %d", i, r.ID)
+		}
+	}
+	if i != n {
+		t.Errorf("decoded %d records, want %d", i, n)
+	}
+	if max := 4096; cap(dec.buf) > max {
+		t.Errorf("buffer grew to %d bytes, want at most %d", cap(dec.buf), max)
+	}
+	for _, want := range []Token{Delim(']'), "total", float64(n), Delim('}')} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Errorf("Token = %v, %v; want %v", tok, err, want)
+		}
+	}
+}
+
+func TestDescendErrors(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		path []string
+		err  string
+	}{
+		{`{"a": {"b": 1}}`, []string{"a", "c"}, `canonicaljson: object member "c" not found`},
+		{`{"a": [{"b": 1}]}`, []string{"a", "b"}, "canonicaljson: cannot unmarshal array into Go value of type map[string]interface {}"},
+		{`{"a": 1, "b"`, []string{"c"}, "unexpected EOF"},
+		{`{"a": [1,`, []string{"b"}, "unexpected EOF"},
+	} {
+		err := NewDecoder(strings.NewReader(tt.in)).Descend(tt.path...)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("Descend(%q) in %s: got error %v, want %s", tt.path, tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	const in = `{"a": [1, -2.5e1, "x\"y", true, false, null], "b\u00e9": {}} "top" 3`
+	want := []struct {
+		kind Kind
+		raw  string
+	}{
+		{'{', `{`}, {'"', `"a"`}, {'[', `[`},
+		{'0', `1`}, {'0', `-2.5e1`}, {'"', `"x\"y"`}, {'t', `true`}, {'f', `false`}, {'n', `null`},
+		{']', `]`}, {'"', `"b\u00e9"`}, {'{', `{`}, {'}', `}`}, {'}', `}`},
+		{'"', `"top"`}, {'0', `3`},
+	}
+	for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+		dec := NewDecoder(r)
+		for _, w := range want {
+			kind, raw, err := dec.ReadToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind != w.kind || string(raw) != w.raw {
+				t.Errorf("ReadToken() = %v, %#q; want %v, %#q", kind, raw, w.kind, w.raw)
+			}
+			if kind == '{' && dec.StackDepth() == 2 {
+				if _, _, key := dec.StackIndex(0); key != "bé" {
+					t.Errorf("StackIndex(0) has key %q, want %q", key, "bé")
+				}
+			}
+		}
+		if kind, raw, err := dec.ReadToken(); err != io.EOF {
+			t.Errorf("ReadToken() at end = %v, %#q, %v; want io.EOF", kind, raw, err)
+		}
+	}
+
+	// ReadToken and Token can be mixed.
+	dec := NewDecoder(strings.NewReader(`[{"k": 1.5}, 2]`))
+	dec.ReadToken()
+	if tok, err := dec.Token(); err != nil || tok != Delim('{') {
+		t.Errorf("Token() = %v, %v; want {", tok, err)
+	}
+	if kind, raw, err := dec.ReadToken(); err != nil || kind != '"' || string(raw) != `"k"` {
+		t.Errorf("ReadToken() = %v, %#q, %v; want string \"k\"", kind, raw, err)
+	}
+	if tok, err := dec.Token(); err != nil || tok != 1.5 {
+		t.Errorf("Token() = %v, %v; want 1.5", tok, err)
+	}
+
+	// Syntax errors are detected.
+	for _, in := range []string{`[1 2]`, `{"a" 1}`, `[1,]`, `{1:2}`, `[tru]`, `]`} {
+		dec := NewDecoder(strings.NewReader(in))
+		var err error
+		for err == nil {
+			_, _, err = dec.ReadToken()
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("ReadToken() in %s: got error %v, want SyntaxError", in, err)
+		}
+	}
+}
+
+func TestReadTokenAllocs(t *testing.T) {
+	const record = `{"id": 12345, "name": "canonical \u00e9", "tags": ["a", "b"], "ok": true} `
+	data := []byte(strings.Repeat(record, 200))
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.ReadToken() // fill the buffer
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, _, err := dec.ReadToken(); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			dec.Reset(bytes.NewReader(data))
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ReadToken allocates %v times per call, want 0", allocs)
+	}
+}
+
+func BenchmarkTokens(b *testing.B) {
+	for _, c := range benchCorpora() {
+		b.Run("Token/"+c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dec := NewDecoder(bytes.NewReader(c.data))
+				for {
+					if _, err := dec.Token(); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run("ReadToken/"+c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(c.data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dec := NewDecoder(bytes.NewReader(c.data))
+				for {
+					if _, _, err := dec.ReadToken(); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSkipValue(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`[{"a": [1, {"b": "]"}], "c": 2, "d": 3}, "x"]`))
+	dec.ReadToken()
+	dec.ReadToken()
+	// Skip the member "a", then the value of "c".
+	if err := dec.SkipValue(); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := dec.Token(); err != nil || tok != "c" {
+		t.Fatalf("Token() = %v, %v; want c", tok, err)
+	}
+	if err := dec.SkipValue(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Token{"d", float64(3), Delim('}')} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Fatalf("Token() = %v, %v; want %v", tok, err, want)
+		}
+	}
+	if err := dec.SkipValue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.SkipValue(); err == nil {
+		t.Error("SkipValue() before ]: expected error")
+	}
+	if tok, err := dec.Token(); err != nil || tok != Delim(']') {
+		t.Errorf("Token() = %v, %v; want ]", tok, err)
+	}
+	if err := dec.SkipValue(); err != io.EOF {
+		t.Errorf("SkipValue() at end: got error %v, want io.EOF", err)
+	}
+}
+
+func TestExactFieldNames(t *testing.T) {
+	type payment struct {
+		Amount int
+		Memo   string `json:"memo"`
+	}
+	const in = `{"Amount":1,"amount":2,"memo":"m","MEMO":"x","z":true}`
+	for _, tt := range []struct {
+		exact, strict bool
+		want          payment
+		err           error
+	}{
+		{want: payment{Amount: 2, Memo: "x"}},
+		{exact: true, want: payment{Amount: 1, Memo: "m"}},
+		{
+			exact: true, strict: true,
+			want: payment{Amount: 1, Memo: "m"},
+			err:  &FieldCaseError{"amount", "Amount", reflect.TypeOf(payment{}), 21},
+		},
+	} {
+		dec := NewDecoder(strings.NewReader(in))
+		if tt.exact {
+			dec.ExactFieldNames(tt.strict)
+		}
+		var got payment
+		err := dec.Decode(&got)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("exact=%v strict=%v: got error %v, want %v", tt.exact, tt.strict, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("exact=%v strict=%v: got %+v, want %+v", tt.exact, tt.strict, got, tt.want)
+		}
+	}
+}
+
+// A struct with an inline field matches exact names regardless of
+// ExactFieldNames, so that it re-marshals to its input.
+func TestExactFieldNamesInline(t *testing.T) {
+	type named struct {
+		Name  string                `json:"name"`
+		Extra map[string]RawMessage `json:",inline"`
+	}
+	for _, in := range []string{
+		`{"NAME":"x","name":"y","z":1}`,
+		`{"NAME":"x","name":"","z":1}`,
+		`{"Name":"x","name":"y"}`,
+	} {
+		for _, exact := range []bool{false, true} {
+			dec := NewDecoder(strings.NewReader(in))
+			if exact {
+				dec.ExactFieldNames(true)
+			}
+			var v named
+			if err := dec.Decode(&v); err != nil {
+				t.Errorf("exact=%v: Decode(%#q): %v", exact, in, err)
+				continue
+			}
+			out, err := Marshal(v)
+			if err != nil {
+				t.Errorf("exact=%v: Marshal(%+v): %v", exact, v, err)
+			} else if string(out) != in {
+				t.Errorf("exact=%v: round trip of %#q = %#q", exact, in, out)
+			}
+		}
+	}
+}
+
+func TestExactNumbers(t *testing.T) {
+	type amounts struct {
+		F64 float64
+		F32 float32
+		Any interface{}
+		Int int64
+	}
+	for _, tt := range []struct {
+		in   string
+		want amounts
+		err  error
+	}{
+		{in: `{"F64":0.1,"F32":0.1,"Any":-0,"Int":9007199254740993}`, want: amounts{0.1, 0.1, 0.0, 9007199254740993}},
+		{in: `{"F64":1e3,"F32":16777216,"Any":1.0E-400}`, want: amounts{1000, 16777216, 0.0, 0}, err: &PrecisionError{"1.0E-400", reflect.TypeOf(0.0), 40}},
+		{in: `{"F64":9007199254740993}`, want: amounts{F64: 9007199254740992}, err: &PrecisionError{"9007199254740993", reflect.TypeOf(0.0), 23}},
+		{in: `{"F32":16777217}`, want: amounts{F32: 16777216}, err: &PrecisionError{"16777217", reflect.TypeOf(float32(0)), 15}},
+		{in: `{"Any":0.1000000000000000055511151231257827}`, want: amounts{Any: 0.1}, err: &PrecisionError{"0.1000000000000000055511151231257827", reflect.TypeOf(0.0), 43}},
+	} {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		dec.ExactNumbers()
+		var got amounts
+		err := dec.Decode(&got)
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("Decode(%#q): got error %v, want %v", tt.in, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Decode(%#q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+
+		// Without ExactNumbers, the same values decode without error.
+		var lossy amounts
+		if err := Unmarshal([]byte(tt.in), &lossy); err != nil || !reflect.DeepEqual(lossy, tt.want) {
+			t.Errorf("Unmarshal(%#q) = %+v, %v, want %+v", tt.in, lossy, err, tt.want)
+		}
+	}
+}
+
 func diff(t *testing.T, a, b []byte) {
 	for i := 0; ; i++ {
 		if i >= len(a) || i >= len(b) || a[i] != b[i] {
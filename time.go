@@ -0,0 +1,240 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Time is a time.Time with a canonical JSON encoding: an RFC 3339 string
+// in UTC with no trailing zeros in the fractional second (and no
+// fractional second at all if it would be zero), such as
+// "2006-01-02T15:04:05.5Z". Every representation of an instant therefore
+// encodes identically, regardless of its location or monotonic clock
+// reading. Unmarshal accepts any RFC 3339 string and converts it to UTC.
+type Time struct {
+	time.Time
+}
+
+// UnixTime is a time.Time that encodes as an integer number of seconds
+// since the Unix epoch. Marshal fails for a time with a fractional second.
+// Unmarshal accepts any JSON number with an integer value, and produces a
+// time in UTC.
+type UnixTime struct {
+	time.Time
+}
+
+// UnixMilliTime is like UnixTime, but counts milliseconds rather than
+// seconds.
+type UnixMilliTime struct {
+	time.Time
+}
+
+// Duration is a time.Duration that encodes as the string returned by its
+// String method, such as "1h30m0.5s". Unmarshal accepts any string
+// accepted by time.ParseDuration.
+type Duration time.Duration
+
+// String returns time.Duration(d).String().
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+const canonicalTimeFormat = `"2006-01-02T15:04:05.999999999Z"`
+
+var (
+	errTimeYear          = errors.New("canonicaljson: Time year outside of range [0,9999]")
+	errUnixFraction      = errors.New("canonicaljson: UnixTime has a fractional second")
+	errUnixMilliFraction = errors.New("canonicaljson: UnixMilliTime has a fractional millisecond")
+	errUnixOutOfRange    = errors.New("canonicaljson: Unix time out of range")
+)
+
+// AppendCanonicalJSON implements AppendMarshaler.
+func (t Time) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	u := t.UTC()
+	if y := u.Year(); y < 0 || y > 9999 {
+		return dst, errTimeYear
+	}
+	return u.AppendFormat(dst, canonicalTimeFormat), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Time) MarshalJSON() ([]byte, error) {
+	return t.AppendCanonicalJSON(nil)
+}
+
+// UnmarshalCanonicalJSON implements CanonicalUnmarshaler.
+func (t *Time) UnmarshalCanonicalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	s, ok := unquote(data)
+	if !ok {
+		return &UnmarshalTypeError{jsonKind(data), reflect.TypeOf(t).Elem(), 0}
+	}
+	u, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	t.Time = u.UTC()
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	return unmarshalCanonical(t, data)
+}
+
+// AppendCanonicalJSON implements AppendMarshaler.
+func (t UnixTime) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	if t.Nanosecond() != 0 {
+		return dst, errUnixFraction
+	}
+	return strconv.AppendInt(dst, t.Unix(), 10), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t UnixTime) MarshalJSON() ([]byte, error) {
+	return t.AppendCanonicalJSON(nil)
+}
+
+// UnmarshalCanonicalJSON implements CanonicalUnmarshaler.
+func (t *UnixTime) UnmarshalCanonicalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	n, err := jsonInteger(data, reflect.TypeOf(t).Elem())
+	if err != nil {
+		return err
+	}
+	if !n.IsInt64() {
+		return errUnixOutOfRange
+	}
+	t.Time = time.Unix(n.Int64(), 0).UTC()
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *UnixTime) UnmarshalJSON(data []byte) error {
+	return unmarshalCanonical(t, data)
+}
+
+// AppendCanonicalJSON implements AppendMarshaler.
+func (t UnixMilliTime) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	ns := int64(t.Nanosecond())
+	if ns%1e6 != 0 {
+		return dst, errUnixMilliFraction
+	}
+	// Seconds since the epoch can exceed the range of int64 once scaled.
+	n := big.NewInt(t.Unix())
+	n.Mul(n, big.NewInt(1000)).Add(n, big.NewInt(ns/1e6))
+	return n.Append(dst, 10), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t UnixMilliTime) MarshalJSON() ([]byte, error) {
+	return t.AppendCanonicalJSON(nil)
+}
+
+// UnmarshalCanonicalJSON implements CanonicalUnmarshaler.
+func (t *UnixMilliTime) UnmarshalCanonicalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	n, err := jsonInteger(data, reflect.TypeOf(t).Elem())
+	if err != nil {
+		return err
+	}
+	sec, ms := n.DivMod(n, big.NewInt(1000), new(big.Int))
+	if !sec.IsInt64() {
+		return errUnixOutOfRange
+	}
+	t.Time = time.Unix(sec.Int64(), ms.Int64()*1e6).UTC()
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *UnixMilliTime) UnmarshalJSON(data []byte) error {
+	return unmarshalCanonical(t, data)
+}
+
+// AppendCanonicalJSON implements AppendMarshaler.
+func (d Duration) AppendCanonicalJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, '"')
+	dst = append(dst, d.String()...)
+	return append(dst, '"'), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return d.AppendCanonicalJSON(nil)
+}
+
+// UnmarshalCanonicalJSON implements CanonicalUnmarshaler.
+func (d *Duration) UnmarshalCanonicalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	s, ok := unquote(data)
+	if !ok {
+		return &UnmarshalTypeError{jsonKind(data), reflect.TypeOf(d).Elem(), 0}
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	return unmarshalCanonical(d, data)
+}
+
+// unmarshalCanonical passes the canonical form of data to u, for
+// implementing UnmarshalJSON in terms of UnmarshalCanonicalJSON.
+func unmarshalCanonical(u CanonicalUnmarshaler, data []byte) error {
+	canonical, err := canonicalize(data)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalCanonicalJSON(canonical)
+}
+
+// jsonInteger returns the value of data, a JSON number in canonical form,
+// or an UnmarshalTypeError for t if it is not an integer.
+func jsonInteger(data []byte, t reflect.Type) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(string(data), 10)
+	if !ok {
+		kind := jsonKind(data)
+		if kind == "number" {
+			kind += " " + string(data)
+		}
+		return nil, &UnmarshalTypeError{kind, t, 0}
+	}
+	return n, nil
+}
+
+// jsonKind describes the JSON value in data for an UnmarshalTypeError.
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
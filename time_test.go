@@ -0,0 +1,110 @@
+// Copyright 2016 Richard Gibson. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canonicaljson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	zoneEast = time.FixedZone("", 5*3600+30*60)
+	instant  = time.Date(2016, 3, 9, 12, 30, 15, 500000000, time.UTC)
+)
+
+var timeMarshalTests = []struct {
+	in   interface{}
+	want string // empty if Marshal should fail
+}{
+	{Time{instant}, `"2016-03-09T12:30:15.5Z"`},
+	{Time{instant.In(zoneEast)}, `"2016-03-09T12:30:15.5Z"`},
+	{Time{instant.Truncate(time.Second)}, `"2016-03-09T12:30:15Z"`},
+	{Time{instant.Add(1)}, `"2016-03-09T12:30:15.500000001Z"`},
+	{Time{}, `"0001-01-01T00:00:00Z"`},
+	{Time{time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)}, ``},
+	{Time{time.Date(0, 1, 1, 0, 0, 0, 0, zoneEast)}, ``},
+	{UnixTime{instant.Truncate(time.Second).In(zoneEast)}, `1457526615`},
+	{UnixTime{time.Unix(-1, 0)}, `-1`},
+	{UnixTime{instant}, ``},
+	{UnixMilliTime{instant}, `1457526615500`},
+	{UnixMilliTime{time.Unix(-1, 5e8)}, `-500`},
+	{UnixMilliTime{instant.Add(1)}, ``},
+	{Duration(90*time.Minute + 500*time.Millisecond), `"1h30m0.5s"`},
+	{Duration(-1500), `"-1.5µs"`},
+	{Duration(0), `"0s"`},
+	{struct {
+		D Duration `json:"d"`
+		T Time     `json:"t"`
+	}{Duration(time.Second), Time{instant}}, `{"d":"1s","t":"2016-03-09T12:30:15.5Z"}`},
+}
+
+func TestTimeMarshal(t *testing.T) {
+	for _, tt := range timeMarshalTests {
+		got, err := Marshal(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Marshal(%v) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", tt.in, err)
+		} else if string(got) != tt.want {
+			t.Errorf("Marshal(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+
+		// encoding/json produces the same output.
+		if got, err := json.Marshal(tt.in); err != nil || string(got) != tt.want {
+			t.Errorf("json.Marshal(%v) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+var timeUnmarshalTests = []struct {
+	in   string
+	ptr  interface{}
+	want interface{} // nil if Unmarshal should fail
+}{
+	{`"2016-03-09T12:30:15.5Z"`, new(Time), Time{instant}},
+	{`"2016-03-09T18:00:15.500+05:30"`, new(Time), Time{instant}},
+	{`"2016-03-09T12:30:15.50000Z"`, new(Time), Time{instant}},
+	{`null`, new(Time), Time{}},
+	{`"2016-03-09"`, new(Time), nil},
+	{`1457526615`, new(Time), nil},
+	{`1457526615`, new(UnixTime), UnixTime{instant.Truncate(time.Second)}},
+	{`1.457526615E9`, new(UnixTime), UnixTime{instant.Truncate(time.Second)}},
+	{`1457526615.5`, new(UnixTime), nil},
+	{`"1457526615"`, new(UnixTime), nil},
+	{`1E19`, new(UnixTime), nil},
+	{`1457526615500`, new(UnixMilliTime), UnixMilliTime{instant}},
+	{`-500`, new(UnixMilliTime), UnixMilliTime{time.Unix(-1, 5e8).UTC()}},
+	{`"1h30m0.5s"`, new(Duration), Duration(90*time.Minute + 500*time.Millisecond)},
+	{`"90m500ms"`, new(Duration), Duration(90*time.Minute + 500*time.Millisecond)},
+	{`"-1.5us"`, new(Duration), Duration(-1500)},
+	{`1500`, new(Duration), nil},
+	{`"1 hour"`, new(Duration), nil},
+}
+
+func TestTimeUnmarshal(t *testing.T) {
+	for _, tt := range timeUnmarshalTests {
+		for _, unmarshal := range []func([]byte, interface{}) error{Unmarshal, json.Unmarshal} {
+			v := reflect.New(reflect.TypeOf(tt.ptr).Elem())
+			err := unmarshal([]byte(tt.in), v.Interface())
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("Unmarshal(%#q, %T) = %v, want error", tt.in, tt.ptr, v.Elem())
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Unmarshal(%#q, %T): %v", tt.in, tt.ptr, err)
+			} else if got := v.Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal(%#q, %T) = %v, want %v", tt.in, tt.ptr, got, tt.want)
+			}
+		}
+	}
+}